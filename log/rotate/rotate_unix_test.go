@@ -1,3 +1,5 @@
+//go:build !windows
+
 /*
 GX (github.com/burningxflame/gx).
 Copyright © 2022-2024 BurningXFlame. All rights reserved.
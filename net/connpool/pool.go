@@ -9,6 +9,7 @@ Read the LICENSE file for details.
 package connpool
 
 import (
+	"context"
 	"errors"
 	"net"
 	"time"
@@ -21,6 +22,9 @@ type Conf struct {
 	Cap  int // Max number of connections in the pool
 	// Used to create a connection
 	New func() (net.Conn, error)
+	// Used to create a connection. Used instead of New if set.
+	// ctx is cancelled once Timeout elapses, so that a stuck call returns rather than leaking.
+	NewCtx func(ctx context.Context) (net.Conn, error)
 	// Used to check whether a connection is still connected. Ping returns nil if still connected.
 	Ping func(net.Conn) error
 	// Timeout of New and Ping. Abandon the call to New or Ping after the timeout elapses.
@@ -36,12 +40,20 @@ func (c *Conf) adjust() error {
 		c.Cap = 1
 	}
 
-	if c.Init > c.Cap || c.New == nil || c.Ping == nil {
+	if c.Init > c.Cap || (c.New == nil && c.NewCtx == nil) || c.Ping == nil {
 		return errInvalidConf
 	}
 
-	if c.Timeout > 0 {
+	if c.NewCtx != nil {
+		newCtx := timeouts.WithTimeoutCtxO(c.Timeout, nil, c.NewCtx)
+		c.New = func() (net.Conn, error) {
+			return newCtx(context.Background())
+		}
+	} else if c.Timeout > 0 {
 		c.New = timeouts.WithTimeoutO(c.Timeout, c.New)
+	}
+
+	if c.Timeout > 0 {
 		c.Ping = timeouts.WithTimeoutI(c.Timeout, c.Ping)
 	}
 
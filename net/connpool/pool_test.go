@@ -9,6 +9,7 @@ Read the LICENSE file for details.
 package connpool
 
 import (
+	"context"
 	"errors"
 	"net"
 	"strconv"
@@ -33,6 +34,7 @@ func TestNew(t *testing.T) {
 		{Conf{Init: -1, Cap: 16, New: newFakeConn, Ping: pingOk}, true},
 		{Conf{Init: 0, Cap: 1, New: newFakeConn, Ping: pingOk}, true},
 		{Conf{Init: 0, Cap: 0, New: newFakeConn, Ping: pingOk}, true},
+		{Conf{Init: 8, Cap: 16, NewCtx: newFakeConnCtx, Ping: pingOk, Timeout: time.Second}, true},
 
 		{Conf{Init: 2, Cap: 1, New: newFakeConn, Ping: pingOk}, false},
 		{Conf{Init: 8, Cap: 16, New: nil, Ping: pingOk}, false},
@@ -194,6 +196,10 @@ func newFakeConn() (net.Conn, error) {
 	}, nil
 }
 
+func newFakeConnCtx(context.Context) (net.Conn, error) {
+	return newFakeConn()
+}
+
 type fakeConn struct {
 	net.Conn
 	closed bool
@@ -10,25 +10,48 @@ package autoreload
 
 import (
 	"context"
-	"errors"
-	"sync"
-
-	"github.com/fsnotify/fsnotify"
+	"reflect"
+	"time"
 
 	"github.com/burningxflame/gx/log/log"
 	"github.com/burningxflame/gx/reliable/backoff"
 	"github.com/burningxflame/gx/reliable/guard"
 )
 
-type Conf[C comparable] struct {
-	// Path of the config file
+type Conf[C any] struct {
+	// Where configs come from, e.g. File, Env, HTTP or UDS.
+	// Default to a File built from Path, Watch, Debounce and Load.
+	Source Source[C]
+	// Path, Watch, Debounce and Load are used by the default Source, and ignored if Source is set.
+	// Path of the config file. May be a symlink, in which case changes of the target are also watched.
 	Path string
-	// Used to load config file on file write event. The returned C is the loaded config.
-	// If C is the same as the last, it's ignored.
+	// Additional files to watch, e.g. included files. Either paths or glob patterns, e.g. conf.d/*.yaml.
+	// Only the base name of a pattern may contain wildcards. Relative to the dir of Path.
+	// A change of any of them triggers Load(Path).
+	Watch []string
+	// Quiet period after the last file event before loading, so that a burst of events (e.g. of a single save) triggers only one load.
+	// Default to 100ms.
+	Debounce time.Duration
+	// Used to load config file on changes. The returned C is the loaded config.
 	Load func(path string) (C, error)
-	// Process is the func to be reloaded. C is the config loaded by Load.
+	// Used to compare configs. If a config equals the current one, it's ignored.
+	// Default to reflect.DeepEqual.
+	Equal func(a, b C) bool
+	// Used to validate a loaded config. If it returns an error, the config is rejected, and the current one keeps running.
+	// Optional.
+	Validate func(c C) error
+	// Process is the func to be reloaded. C is the config from Source.
 	// Process should return ASAP when ctx.Done channel is closed.
 	Process func(ctx context.Context, c C)
+	// How the old Process hands over to the new one on reload. Default to StopFirst.
+	HandOver HandOver
+	// In StartFirst mode, if the new Process does not call Ready within ReadyTimeout, it's stopped, and the old one keeps running.
+	// Default to 10s.
+	ReadyTimeout time.Duration
+	// If Process returns by itself within Grace after a reload, the new config is deemed bad,
+	// and Process is re-run with the last good config, i.e. the last one whose Process ran longer than Grace.
+	// Default to 0, i.e. no rollback.
+	Grace time.Duration
 	// Backoff strategy determines how long to wait between retries.
 	Bf backoff.Conf
 	// Used to tag log messages
@@ -37,15 +60,29 @@ type Conf[C comparable] struct {
 	Log log.TagLogger
 }
 
-// Watch a config file, and re-run a func on config changes.
-// Will retry watching if the conf file is removed.
-func WithAutoReload[C comparable](ctx context.Context, cf Conf[C]) {
+// Watch a config source, and re-run a func on config changes.
+// Will re-run the source with backoff if it fails.
+func WithAutoReload[C any](ctx context.Context, cf Conf[C]) {
 	if cf.Log == nil {
 		cf.Log = log.WithTag("")
 	}
 	lg := cf.Log.WithTag("autoReload " + cf.Tag)
 	lg.Info("starting")
 
+	if cf.Source == nil {
+		cf.Source = &File[C]{
+			Path:     cf.Path,
+			Watch:    cf.Watch,
+			Debounce: cf.Debounce,
+			Load:     cf.Load,
+		}
+	}
+	if cf.Equal == nil {
+		cf.Equal = func(a, b C) bool {
+			return reflect.DeepEqual(a, b)
+		}
+	}
+
 	ch := make(chan C, 1)
 	done := make(chan struct{})
 
@@ -55,119 +92,108 @@ func WithAutoReload[C comparable](ctx context.Context, cf Conf[C]) {
 		guard.WithGuard(ctx, guard.Conf{
 			Tag: "watch " + cf.Tag,
 			Fn: func(ctx context.Context) error {
-				return watch(ctx, cf.Path, cf.Load, ch, lg)
+				return cf.Source.Run(ctx, ch, lg)
 			},
 			Bf:                 cf.Bf,
 			AlsoRetryOnSuccess: true,
 		})
 	}()
 
-	reload(ctx, cf.Process, ch, lg)
+	reload(ctx, cf, ch, lg)
 
 	<-done
 }
 
-func watch[C comparable](
+func reload[C any](
 	ctx context.Context,
-	path string,
-	load func(string) (C, error),
-	ch chan<- C,
+	cf Conf[C],
+	ch <-chan C,
 	lg log.TagLogger,
-) error {
-	val, err := load(path)
-	if err != nil {
-		return err
+) {
+	var (
+		// the current run
+		cur *run[C]
+		// the last good config
+		good    C
+		hasGood bool
+	)
+
+	// Whether the current run has outlived the grace period
+	survived := func() bool {
+		return cf.Grace <= 0 || time.Since(cur.from) >= cf.Grace
 	}
 
-	ch <- val
-
-	_load := func(path string) {
-		val, err := load(path)
-		if err != nil {
-			lg.Error("error loading conf: %v", err)
-			return
+	for {
+		// Exits of the current run which returns by itself
+		var exited <-chan struct{}
+		if cur != nil && !cur.exited {
+			exited = cur.done
 		}
 
-		ch <- val
-	}
-
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		return err
-	}
-	defer watcher.Close()
-
-	err = watcher.Add(path)
-	if err != nil {
-		return err
-	}
-
-	for {
 		select {
 		case <-ctx.Done():
-			return nil
+			lg.Info("received exit signal, exiting")
+			if cur != nil {
+				cur.stop()
+			}
+			return
 
-		case event, ok := <-watcher.Events:
-			if !ok {
-				return nil
+		case v := <-ch:
+			if cur != nil && cf.Equal(v, cur.val) {
+				lg.Info("ignore because of no change")
+				continue
 			}
 
-			if event.Op&fsnotify.Write == fsnotify.Write {
-				_load(path)
-			} else if event.Op&fsnotify.Remove == fsnotify.Remove {
-				return errRemove
+			if cf.Validate != nil {
+				err := cf.Validate(v)
+				if err != nil {
+					lg.Error("invalid conf, keep the current one: %v", err)
+					continue
+				}
 			}
 
-		case err, ok := <-watcher.Errors:
-			if !ok {
-				return nil
+			if cur != nil && survived() {
+				good, hasGood = cur.val, true
 			}
 
-			return err
-		}
-	}
-}
+			lg.Info("reloading on change")
 
-var errRemove = errors.New("file was removed")
+			if cf.HandOver == StartFirst && cur != nil && !cur.exited {
+				next := startRun(ctx, cf.Process, v)
+				err := next.waitReady(ctx, cf.ReadyTimeout)
+				if err != nil {
+					lg.Error("%v, keep the current one", err)
+					next.stop()
+					continue
+				}
+
+				cur.stop()
+				cur = next
+				continue
+			}
 
-func reload[C comparable](
-	ctx context.Context,
-	fn func(context.Context, C),
-	ch <-chan C,
-	lg log.TagLogger,
-) {
-	var val C
-	var ctxFn context.Context
-	var cancelFn context.CancelFunc = func() {}
-	var wgFn sync.WaitGroup
+			if cur != nil {
+				cur.stop()
+			}
+			cur = startRun(ctx, cf.Process, v)
 
-	for {
-		select {
-		case <-ctx.Done():
-			lg.Info("received exit signal, exiting")
-			cancelFn()
-			wgFn.Wait()
-			return
+		case <-exited:
+			cur.exited = true
 
-		case v := <-ch:
-			if v == val {
-				lg.Info("ignore because of no change")
+			if survived() {
+				good, hasGood = cur.val, true
+				lg.Info("process exited")
 				continue
 			}
 
-			val = v
-
-			lg.Info("reloading on change")
-
-			cancelFn()
-			wgFn.Wait()
+			if !hasGood || cf.Equal(good, cur.val) {
+				lg.Warn("process exited in %v", time.Since(cur.from))
+				continue
+			}
 
-			ctxFn, cancelFn = context.WithCancel(ctx)
-			wgFn.Add(1)
-			go func() {
-				defer wgFn.Done()
-				fn(ctxFn, val)
-			}()
+			lg.Warn("process exited in %v after reload, roll back to the last good conf", time.Since(cur.from))
+			cur.stop()
+			cur = startRun(ctx, cf.Process, good)
 		}
 	}
 }
@@ -10,6 +10,7 @@ package autoreload
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
@@ -78,11 +79,12 @@ func testAutoReload(t *testing.T, tc testCase) {
 		}
 
 		WithAutoReload(ctx, Conf[string]{
-			Tag:     tc.tag,
-			Path:    pa,
-			Load:    load,
-			Process: process,
-			Bf:      bf,
+			Tag:      tc.tag,
+			Path:     pa,
+			Debounce: time.Millisecond * 2,
+			Load:     load,
+			Process:  process,
+			Bf:       bf,
 		})
 	}()
 
@@ -120,3 +122,79 @@ func process(ctx context.Context, conf string, actual *[]string) {
 
 	<-ctx.Done()
 }
+
+func TestDebounce(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Debounce: time.Millisecond * 50, Load: load})
+	eventually(t, r, "a")
+
+	// A burst of writes triggers only one reload.
+	for _, txt := range []string{"b", "c", "d"} {
+		as.Nil(os.WriteFile(pa, []byte(txt), 0600))
+		time.Sleep(time.Millisecond * 5)
+	}
+	eventually(t, r, "d")
+	as.Equal([]string{"a", "d"}, r.all())
+}
+
+func TestValidate(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	validate := func(c string) error {
+		if c == "bad" {
+			return errors.New("bad conf")
+		}
+		return nil
+	}
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Load: load, Validate: validate})
+	eventually(t, r, "a")
+
+	// rejected, and the current one keeps running
+	as.Nil(os.WriteFile(pa, []byte("bad"), 0600))
+	time.Sleep(time.Millisecond * 50)
+	as.Equal([]string{"a"}, r.all())
+
+	as.Nil(os.WriteFile(pa, []byte("b"), 0600))
+	eventually(t, r, "b")
+	as.Equal([]string{"a", "b"}, r.all())
+}
+
+func TestRollback(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	// Fail fast with a bad config
+	process := func(ctx context.Context, c string) {
+		if c == "bad" {
+			return
+		}
+		<-ctx.Done()
+	}
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Load: load, Process: process, Grace: time.Millisecond * 100})
+	eventually(t, r, "a")
+
+	// Let a run longer than Grace, so that it's deemed good.
+	time.Sleep(time.Millisecond * 150)
+
+	as.Nil(os.WriteFile(pa, []byte("bad"), 0600))
+	require.Eventually(t, func() bool {
+		return r.len() == 3
+	}, time.Second, time.Millisecond*5)
+	as.Equal([]string{"a", "bad", "a"}, r.all())
+
+	// Not rolled back again, and later changes are still applied.
+	as.Nil(os.WriteFile(pa, []byte("b"), 0600))
+	eventually(t, r, "b")
+	as.Equal([]string{"a", "bad", "a", "b"}, r.all())
+}
@@ -0,0 +1,297 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// A Source which loads configs from a file.
+// Parent dirs are watched rather than files, so that saves via rename (e.g. by editors) and symlink swaps (e.g. of Kubernetes ConfigMaps) are handled.
+// A file being removed is not an error, and the file is loaded again once it's back.
+type File[C any] struct {
+	// Path of the config file. May be a symlink, in which case changes of the target are also watched.
+	Path string
+	// Additional files to watch, e.g. included files. Either paths or glob patterns, e.g. conf.d/*.yaml.
+	// Only the base name of a pattern may contain wildcards. Relative to the dir of Path.
+	// A change of any of them triggers Load(Path).
+	Watch []string
+	// Quiet period after the last file event before loading, so that a burst of events (e.g. of a single save) triggers only one load.
+	// Default to 100ms.
+	Debounce time.Duration
+	// Used to load the config file.
+	Load func(path string) (C, error)
+}
+
+const defDebounce = time.Millisecond * 100
+
+// Watch parent dirs of the config file and additional files, and send the loaded config to ch on changes.
+// A change is detected by comparing fingerprints of files, i.e. resolved paths and hashes of contents,
+// so events which do not change any file (e.g. of other files in the same dir) are ignored.
+// Return an error if a watched dir is removed.
+func (f *File[C]) Run(ctx context.Context, ch chan<- C, lg log.TagLogger) error {
+	debounce := f.Debounce
+	if debounce <= 0 {
+		debounce = defDebounce
+	}
+
+	path := f.Path
+	w := watcher{path: path}
+	w.patterns = absPatterns(path, f.Watch)
+
+	for _, p := range w.patterns {
+		if hasMeta(filepath.Dir(p)) {
+			return fmt.Errorf("invalid pattern %v: only the base name may contain wildcards", p)
+		}
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	w.fw = fw
+	w.dirs = make(map[string]bool)
+
+	// Watch before loading, in order not to miss changes in between.
+	err = w.syncDirs()
+	if err != nil {
+		return err
+	}
+
+	fp := w.fingerprint()
+	val, err := f.Load(path)
+	if err != nil {
+		return fmt.Errorf("error loading conf: %w", err)
+	}
+	if !send(ctx, ch, val) {
+		return nil
+	}
+
+	// Debounce a burst of events, e.g. truncating and then writing a file, into one check.
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+
+			if w.dirs[event.Name] && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				return errRemove
+			}
+
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(debounce)
+			continue
+
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+
+			return err
+
+		case <-timer.C:
+		}
+
+		// Symlink targets may have changed.
+		err := w.syncDirs()
+		if err != nil {
+			return err
+		}
+
+		newFp := w.fingerprint()
+		if newFp == fp {
+			continue
+		}
+		fp = newFp
+
+		if _, err := os.Stat(path); err != nil {
+			lg.Warn("config file not accessible, wait for it to be back: %v", err)
+			continue
+		}
+
+		val, err := f.Load(path)
+		if err != nil {
+			lg.Error("error loading conf, keep the current one: %v", err)
+			continue
+		}
+
+		if !send(ctx, ch, val) {
+			return nil
+		}
+	}
+}
+
+var errRemove = errors.New("watched dir was removed")
+
+type watcher struct {
+	path     string
+	patterns []string
+	fw       *fsnotify.Watcher
+	// watched dirs. true if required, i.e. a parent dir of path or patterns.
+	dirs map[string]bool
+}
+
+// Return the watched files, i.e. path and files matched by patterns, sorted.
+func (w *watcher) files() []string {
+	files := []string{w.path}
+	seen := map[string]struct{}{w.path: {}}
+
+	for _, p := range w.patterns {
+		// Patterns are validated.
+		matches, _ := filepath.Glob(p)
+		for _, f := range matches {
+			if _, ok := seen[f]; !ok {
+				seen[f] = struct{}{}
+				files = append(files, f)
+			}
+		}
+	}
+
+	sort.Strings(files[1:])
+	return files
+}
+
+// Watch parent dirs of path and patterns, and dirs of symlink targets. Unwatch dirs no longer needed.
+func (w *watcher) syncDirs() error {
+	want := map[string]bool{
+		filepath.Dir(w.path): true,
+	}
+	for _, p := range w.patterns {
+		want[filepath.Dir(p)] = true
+	}
+
+	for _, f := range w.files() {
+		target, err := filepath.EvalSymlinks(f)
+		if err != nil || target == f {
+			continue
+		}
+
+		dir := filepath.Dir(target)
+		if _, ok := want[dir]; !ok {
+			want[dir] = false
+		}
+	}
+
+	for dir := range w.dirs {
+		if _, ok := want[dir]; !ok {
+			_ = w.fw.Remove(dir)
+			delete(w.dirs, dir)
+		}
+	}
+
+	for dir, required := range want {
+		if _, ok := w.dirs[dir]; ok {
+			w.dirs[dir] = required
+			continue
+		}
+
+		err := w.fw.Add(dir)
+		if err != nil {
+			if required {
+				return err
+			}
+			continue
+		}
+
+		w.dirs[dir] = required
+	}
+
+	return nil
+}
+
+// Fingerprint of the watched files
+func (w *watcher) fingerprint() string {
+	var b strings.Builder
+
+	for _, f := range w.files() {
+		b.WriteString(f)
+		b.WriteByte(0)
+
+		target, err := filepath.EvalSymlinks(f)
+		if err != nil {
+			b.WriteString("-\n")
+			continue
+		}
+		b.WriteString(target)
+		b.WriteByte(0)
+
+		sum, err := hashFile(target)
+		if err != nil {
+			b.WriteString("-\n")
+			continue
+		}
+		b.WriteString(sum)
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+func hashFile(pa string) (string, error) {
+	f, err := os.Open(pa)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func absPatterns(path string, patterns []string) []string {
+	dir := filepath.Dir(path)
+	l := make([]string, 0, len(patterns))
+
+	for _, p := range patterns {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		l = append(l, filepath.Clean(p))
+	}
+
+	return l
+}
+
+func hasMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
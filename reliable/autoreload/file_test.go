@@ -0,0 +1,214 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/backoff"
+)
+
+// Run WithAutoReload in the background, and record the configs passed to Process.
+type recorder struct {
+	mu   sync.Mutex
+	vals []string
+}
+
+func (r *recorder) all() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.vals...)
+}
+
+func (r *recorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.vals) < 1 {
+		return ""
+	}
+	return r.vals[len(r.vals)-1]
+}
+
+func (r *recorder) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.vals)
+}
+
+func startAutoReload(t *testing.T, cf Conf[string]) *recorder {
+	light.InitTestLog()
+
+	r := &recorder{}
+	cf.Tag = t.Name()
+	if cf.Debounce == 0 {
+		cf.Debounce = time.Millisecond * 5
+	}
+
+	// Wait for ctx by default
+	fn := cf.Process
+	if fn == nil {
+		fn = func(ctx context.Context, c string) {
+			<-ctx.Done()
+		}
+	}
+	cf.Process = func(ctx context.Context, c string) {
+		r.mu.Lock()
+		r.vals = append(r.vals, c)
+		r.mu.Unlock()
+
+		fn(ctx, c)
+	}
+	cf.Bf = backoff.Conf{
+		Min:  time.Millisecond,
+		Max:  time.Millisecond * 10,
+		Unit: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		WithAutoReload(ctx, cf)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return r
+}
+
+func eventually(t *testing.T, r *recorder, expect string) {
+	require.Eventually(t, func() bool {
+		return r.last() == expect
+	}, time.Second, time.Millisecond*5, "expect %q, got %q", expect, r.last())
+}
+
+func TestRenameSave(t *testing.T) {
+	as := require.New(t)
+
+	dir := t.TempDir()
+	pa := filepath.Join(dir, "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Load: load})
+	eventually(t, r, "a")
+
+	// like editors: write a temp file, then rename it over the original
+	tmp := filepath.Join(dir, "conf.swp")
+	as.Nil(os.WriteFile(tmp, []byte("b"), 0600))
+	as.Nil(os.Rename(tmp, pa))
+	eventually(t, r, "b")
+
+	as.Nil(os.WriteFile(tmp, []byte("c"), 0600))
+	as.Nil(os.Rename(tmp, pa))
+	eventually(t, r, "c")
+
+	// changes of other files in the dir are ignored
+	as.Nil(os.WriteFile(filepath.Join(dir, "other"), []byte("x"), 0600))
+	time.Sleep(time.Millisecond * 50)
+	as.Equal(3, r.len())
+}
+
+// Like Kubernetes ConfigMap volumes:
+//
+//	conf -> ..data/conf
+//	..data -> ..v1
+func TestSymlinkSwap(t *testing.T) {
+	as := require.New(t)
+
+	dir := t.TempDir()
+	version := func(name, content string) {
+		as.Nil(os.Mkdir(filepath.Join(dir, name), 0700))
+		as.Nil(os.WriteFile(filepath.Join(dir, name, "conf"), []byte(content), 0600))
+	}
+	swap := func(name string) {
+		tmp := filepath.Join(dir, "..data_tmp")
+		as.Nil(os.Symlink(name, tmp))
+		as.Nil(os.Rename(tmp, filepath.Join(dir, "..data")))
+	}
+
+	version("..v1", "a")
+	swap("..v1")
+	pa := filepath.Join(dir, "conf")
+	as.Nil(os.Symlink(filepath.Join("..data", "conf"), pa))
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Load: load})
+	eventually(t, r, "a")
+
+	version("..v2", "b")
+	swap("..v2")
+	as.Nil(os.RemoveAll(filepath.Join(dir, "..v1")))
+	eventually(t, r, "b")
+
+	// in-place writes of the target are watched as well
+	as.Nil(os.WriteFile(filepath.Join(dir, "..v2", "conf"), []byte("c"), 0600))
+	eventually(t, r, "c")
+}
+
+func TestWatchGlob(t *testing.T) {
+	as := require.New(t)
+
+	dir := t.TempDir()
+	as.Nil(os.Mkdir(filepath.Join(dir, "conf.d"), 0700))
+	pa := filepath.Join(dir, "conf")
+	as.Nil(os.WriteFile(pa, nil, 0600))
+
+	// Load the main file and all included files.
+	loadAll := func(path string) (string, error) {
+		files, err := filepath.Glob(filepath.Join(filepath.Dir(path), "conf.d", "*.yaml"))
+		if err != nil {
+			return "", err
+		}
+		sort.Strings(files)
+
+		var l []string
+		for _, f := range files {
+			bs, err := os.ReadFile(f)
+			if err != nil {
+				return "", err
+			}
+			l = append(l, string(bs))
+		}
+
+		return strings.Join(l, ","), nil
+	}
+
+	r := startAutoReload(t, Conf[string]{Path: pa, Watch: []string{"conf.d/*.yaml"}, Load: loadAll})
+	eventually(t, r, "")
+
+	as.Nil(os.WriteFile(filepath.Join(dir, "conf.d", "a.yaml"), []byte("a"), 0600))
+	eventually(t, r, "a")
+
+	as.Nil(os.WriteFile(filepath.Join(dir, "conf.d", "b.yaml"), []byte("b"), 0600))
+	eventually(t, r, "a,b")
+
+	as.Nil(os.Remove(filepath.Join(dir, "conf.d", "a.yaml")))
+	eventually(t, r, "b")
+
+	// not matched
+	n := r.len()
+	as.Nil(os.WriteFile(filepath.Join(dir, "conf.d", "c.txt"), []byte("c"), 0600))
+	time.Sleep(time.Millisecond * 50)
+	as.Equal(n, r.len())
+}
@@ -0,0 +1,121 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How the old Process hands over to the new one on reload
+type HandOver byte
+
+const (
+	// Stop the old Process, and then start the new one.
+	// There's a gap in between, but two Processes never run at the same time.
+	StopFirst HandOver = iota
+	// Start the new Process, and stop the old one once the new one calls Ready.
+	// Two Processes overlap for a while, e.g. both listening at the same port with SO_REUSEPORT, so there's no gap.
+	StartFirst
+)
+
+func (h HandOver) String() string {
+	switch h {
+	case StopFirst:
+		return "stopFirst"
+	case StartFirst:
+		return "startFirst"
+	default:
+		return fmt.Sprintf("HandOver(%d)", h)
+	}
+}
+
+const defReadyTimeout = time.Second * 10
+
+// Signal that the Process with ctx is ready, e.g. listening, so that the old one can be stopped.
+// Should be called by Process in StartFirst mode. A no-op otherwise.
+func Ready(ctx context.Context) {
+	if fn, ok := ctx.Value(readyKey{}).(func()); ok {
+		fn()
+	}
+}
+
+type readyKey struct{}
+
+// A run of Process
+type run[C any] struct {
+	val    C
+	from   time.Time
+	cancel context.CancelFunc
+	// closed when Process returns
+	done chan struct{}
+	// closed when Ready is called
+	ready     chan struct{}
+	readyOnce sync.Once
+	// whether the exit of Process has been handled
+	exited bool
+}
+
+func startRun[C any](ctx context.Context, fn func(context.Context, C), val C) *run[C] {
+	r := &run[C]{
+		val:   val,
+		from:  time.Now(),
+		done:  make(chan struct{}),
+		ready: make(chan struct{}),
+	}
+
+	ctx, r.cancel = context.WithCancel(ctx)
+	ctx = context.WithValue(ctx, readyKey{}, func() {
+		r.readyOnce.Do(func() {
+			close(r.ready)
+		})
+	})
+
+	go func() {
+		defer close(r.done)
+		fn(ctx, val)
+	}()
+
+	return r
+}
+
+// Stop the run, and wait for Process to return.
+func (r *run[C]) stop() {
+	r.cancel()
+	<-r.done
+}
+
+var (
+	errNotReady  = errors.New("new process is not ready in time")
+	errExitEarly = errors.New("new process exited before ready")
+)
+
+// Wait for Process to call Ready.
+func (r *run[C]) waitReady(ctx context.Context, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defReadyTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-r.ready:
+		return nil
+	case <-r.done:
+		return errExitEarly
+	case <-timer.C:
+		return errNotReady
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartFirst(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	// Track running Processes, and whether there's ever no running one.
+	var mu sync.Mutex
+	running := map[string]bool{}
+	var gap bool
+
+	process := func(ctx context.Context, c string) {
+		switch c {
+		case "slow":
+			// never ready
+			<-ctx.Done()
+			return
+		case "bad":
+			// exit before ready
+			return
+		}
+
+		mu.Lock()
+		running[c] = true
+		mu.Unlock()
+		Ready(ctx)
+
+		<-ctx.Done()
+
+		mu.Lock()
+		delete(running, c)
+		if len(running) == 0 {
+			gap = true
+		}
+		mu.Unlock()
+	}
+
+	r := startAutoReload(t, Conf[string]{
+		Path:         pa,
+		Load:         load,
+		Process:      process,
+		HandOver:     StartFirst,
+		ReadyTimeout: time.Millisecond * 50,
+	})
+	eventually(t, r, "a")
+
+	as.Nil(os.WriteFile(pa, []byte("b"), 0600))
+	eventually(t, r, "b")
+
+	// not ready in time, or exit before ready. The old one keeps running.
+	for _, c := range []string{"slow", "bad"} {
+		as.Nil(os.WriteFile(pa, []byte(c), 0600))
+		eventually(t, r, c)
+		time.Sleep(time.Millisecond * 100)
+	}
+
+	as.Nil(os.WriteFile(pa, []byte("c"), 0600))
+	eventually(t, r, "c")
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(running) == 1 && running["c"]
+	}, time.Second, time.Millisecond*5)
+
+	mu.Lock()
+	defer mu.Unlock()
+	as.False(gap)
+}
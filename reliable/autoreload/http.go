@@ -0,0 +1,116 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// A Source which polls configs from an HTTP endpoint.
+// If the endpoint returns an ETag, it's sent back via If-None-Match, and a 304 response means no change.
+type HTTP[C any] struct {
+	// The URL to GET
+	URL string
+	// Used to send requests. Default to an http.Client with a timeout of 10s.
+	Client *http.Client
+	// Interval between polls. Default to 30s.
+	Interval time.Duration
+	// Used to load the config from a response body.
+	Load func(body []byte) (C, error)
+}
+
+const defPollInterval = time.Second * 30
+
+// Poll the endpoint, and send the loaded config to ch on changes.
+// Return an error if a poll fails, so that polling is retried with backoff.
+func (h *HTTP[C]) Run(ctx context.Context, ch chan<- C, lg log.TagLogger) error {
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+
+	interval := h.Interval
+	if interval <= 0 {
+		interval = defPollInterval
+	}
+
+	var etag string
+	var last []byte
+
+	for {
+		body, newEtag, err := h.get(ctx, client, etag)
+		if err != nil {
+			return err
+		}
+
+		// nil if not modified
+		if body != nil {
+			if !bytes.Equal(body, last) {
+				val, err := h.Load(body)
+				if err != nil {
+					return fmt.Errorf("error loading conf: %w", err)
+				}
+
+				if !send(ctx, ch, val) {
+					return nil
+				}
+				last = body
+			}
+
+			etag = newEtag
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// GET the URL. Return a nil body if not modified.
+func (h *HTTP[C]) get(ctx context.Context, client *http.Client, etag string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %v", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if body == nil {
+		body = []byte{}
+	}
+
+	return body, resp.Header.Get("ETag"), nil
+}
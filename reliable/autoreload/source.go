@@ -0,0 +1,105 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// A Source of configs, e.g. File, Env, HTTP or UDS.
+type Source[C any] interface {
+	// Send the current config to ch, and then a new one on each change, until ctx is done.
+	// If it returns an error, it will be re-run with backoff.
+	Run(ctx context.Context, ch chan<- C, lg log.TagLogger) error
+}
+
+// Send val to ch. Return false if ctx is done.
+func send[C any](ctx context.Context, ch chan<- C, val C) bool {
+	select {
+	case ch <- val:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// A Source which loads configs from env vars.
+type Env[C any] struct {
+	// Only env vars with the prefix are passed to Load. Default to all env vars.
+	Prefix string
+	// Interval between checks of env vars, which may be changed via os.Setenv.
+	// Default to 0, i.e. load only once.
+	Interval time.Duration
+	// Used to load the config from env vars, i.e. a map from names to values.
+	Load func(vars map[string]string) (C, error)
+}
+
+// Load the config from env vars, and then re-load it on changes of env vars if Interval > 0.
+func (e *Env[C]) Run(ctx context.Context, ch chan<- C, lg log.TagLogger) error {
+	vars := e.vars()
+	val, err := e.Load(vars)
+	if err != nil {
+		return fmt.Errorf("error loading conf: %w", err)
+	}
+	if !send(ctx, ch, val) {
+		return nil
+	}
+
+	if e.Interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		newVars := e.vars()
+		if reflect.DeepEqual(newVars, vars) {
+			continue
+		}
+		vars = newVars
+
+		val, err := e.Load(vars)
+		if err != nil {
+			lg.Error("error loading conf, keep the current one: %v", err)
+			continue
+		}
+
+		if !send(ctx, ch, val) {
+			return nil
+		}
+	}
+}
+
+func (e *Env[C]) vars() map[string]string {
+	m := make(map[string]string)
+
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(k, e.Prefix) {
+			m[k] = v
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,211 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	uh "github.com/burningxflame/gx/uds/http"
+)
+
+func loadBytes(body []byte) (string, error) {
+	if string(body) == "bad" {
+		return "", errors.New("bad conf")
+	}
+	return string(body), nil
+}
+
+func TestEnv(t *testing.T) {
+	t.Setenv("AR_TEST_A", "a")
+
+	r := startAutoReload(t, Conf[string]{
+		Source: &Env[string]{
+			Prefix:   "AR_TEST_",
+			Interval: time.Millisecond * 5,
+			Load: func(vars map[string]string) (string, error) {
+				return vars["AR_TEST_A"] + vars["AR_TEST_B"], nil
+			},
+		},
+	})
+	eventually(t, r, "a")
+
+	t.Setenv("AR_TEST_B", "b")
+	eventually(t, r, "ab")
+
+	// other env vars are ignored
+	n := r.len()
+	t.Setenv("AR_OTHER", "x")
+	time.Sleep(time.Millisecond * 30)
+	require.Equal(t, n, r.len())
+}
+
+func TestHTTP(t *testing.T) {
+	as := require.New(t)
+
+	var mu sync.Mutex
+	body, status := "a", http.StatusOK
+	set := func(b string, s int) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, status = b, s
+	}
+
+	var notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+
+		etag := `"` + body + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	r := startAutoReload(t, Conf[string]{
+		Source: &HTTP[string]{
+			URL:      srv.URL,
+			Interval: time.Millisecond * 5,
+			Load:     loadBytes,
+		},
+	})
+	eventually(t, r, "a")
+
+	set("b", http.StatusOK)
+	eventually(t, r, "b")
+
+	// errors are retried with backoff, and the current config keeps running
+	set("b", http.StatusInternalServerError)
+	time.Sleep(time.Millisecond * 30)
+	set("bad", http.StatusOK)
+	time.Sleep(time.Millisecond * 30)
+	as.Equal([]string{"a", "b"}, r.all())
+
+	set("c", http.StatusOK)
+	eventually(t, r, "c")
+	as.Equal([]string{"a", "b", "c"}, r.all())
+
+	// unchanged configs are not modified
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return notModified > 0
+	}, time.Second, time.Millisecond*5)
+	as.Equal([]string{"a", "b", "c"}, r.all())
+}
+
+func TestUDS(t *testing.T) {
+	as := require.New(t)
+
+	addr := filepath.Join(t.TempDir(), "push.sock")
+	r := startAutoReload(t, Conf[string]{
+		Source: &UDS[string]{Addr: addr, Load: loadBytes},
+	})
+
+	c := uh.NewClient(addr)
+	c.Timeout = time.Second
+	push := func(body string) int {
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			req, err := http.NewRequest(http.MethodPut, "http://unix/", strings.NewReader(body))
+			as.Nil(err)
+			resp, err = c.Do(req)
+			return err == nil
+		}, time.Second, time.Millisecond*5)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	as.Equal(http.StatusNoContent, push("a"))
+	eventually(t, r, "a")
+
+	as.Equal(http.StatusBadRequest, push("bad"))
+	as.Equal(http.StatusNoContent, push("b"))
+	eventually(t, r, "b")
+	as.Equal([]string{"a", "b"}, r.all())
+}
+
+func TestEqual(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "conf")
+	as.Nil(os.WriteFile(pa, []byte("a"), 0600))
+
+	// Configs are slices, and only the first elements matter.
+	var mu sync.Mutex
+	var vals [][]string
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	go func() {
+		defer close(done)
+
+		WithAutoReload(ctx, Conf[[]string]{
+			Path:     pa,
+			Debounce: time.Millisecond * 5,
+			Load: func(path string) ([]string, error) {
+				bs, err := os.ReadFile(path)
+				return strings.Split(string(bs), ","), err
+			},
+			Equal: func(a, b []string) bool {
+				return a[0] == b[0]
+			},
+			Process: func(ctx context.Context, c []string) {
+				mu.Lock()
+				vals = append(vals, c)
+				mu.Unlock()
+				<-ctx.Done()
+			},
+		})
+	}()
+
+	n := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(vals)
+	}
+
+	require.Eventually(t, func() bool { return n() == 1 }, time.Second, time.Millisecond*5)
+
+	as.Nil(os.WriteFile(pa, []byte("a,x"), 0600))
+	time.Sleep(time.Millisecond * 50)
+	as.Equal(1, n())
+
+	as.Nil(os.WriteFile(pa, []byte("b,x"), 0600))
+	require.Eventually(t, func() bool { return n() == 2 }, time.Second, time.Millisecond*5)
+
+	mu.Lock()
+	defer mu.Unlock()
+	as.Equal([][]string{{"a"}, {"b", "x"}}, vals)
+}
@@ -0,0 +1,86 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package autoreload
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+	uh "github.com/burningxflame/gx/uds/http"
+)
+
+// A Source which receives configs pushed over UDS.
+// A config is pushed via PUT or POST with the config as the body, e.g.
+//
+//	curl --unix-socket /some/path -X PUT --data-binary @conf.yaml http://unix/
+//
+// The response is 204 if the config is accepted, or 400 if Load fails.
+// Nothing is sent to Process until the first push.
+type UDS[C any] struct {
+	// The UDS address to listen
+	Addr string
+	// File permission of the Addr
+	Perm fs.FileMode
+	// Max size of a pushed config. Default to 1MiB.
+	MaxSize int64
+	// Used to load the config from a request body.
+	Load func(body []byte) (C, error)
+}
+
+const defMaxSize = 1 << 20
+
+// Listen at Addr, and send configs pushed to ch.
+func (u *UDS[C]) Run(ctx context.Context, ch chan<- C, lg log.TagLogger) error {
+	maxSize := u.MaxSize
+	if maxSize <= 0 {
+		maxSize = defMaxSize
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		val, err := u.Load(body)
+		if err != nil {
+			lg.Error("error loading pushed conf: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !send(ctx, ch, val) {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	s := &uh.Server{
+		Std:             http.Server{Handler: handler},
+		UdsAddr:         u.Addr,
+		Perm:            u.Perm,
+		ShutdownTimeout: time.Second * 3,
+		Tag:             "push",
+		Log:             lg,
+	}
+	return s.Serve(ctx)
+}
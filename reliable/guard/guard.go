@@ -10,6 +10,7 @@ package guard
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/burningxflame/gx/log/log"
@@ -28,23 +29,124 @@ type Conf struct {
 	Tag string
 	// A TagLogger used to log messages
 	Log log.TagLogger
+	// Observer called on every state transition, with the status after the transition.
+	// Called synchronously in the guarding goroutine, so it should return quickly.
+	// Optional.
+	OnChange func(Status)
+	// If provided, the guard is added to the registry while running, and removed when stopped.
+	// Optional.
+	Registry *Registry
 }
 
 // Auto re-run a function until it succeeds (aka, returns nil error) or ctx.Done channel is closed.
 // If AlsoRetryOnSuccess is true, auto re-run a function until ctx.Done channel is closed.
 func WithGuard(ctx context.Context, cf Conf) {
+	New(cf).Run(ctx)
+}
+
+// Guard is a handle of a guarded function, used to query its status.
+type Guard struct {
+	cf Conf
+
+	mu     sync.Mutex
+	status Status
+}
+
+// State of a guarded function
+type State byte
+
+const (
+	// Not started yet, or exited
+	StateStopped State = iota
+	// Fn is running
+	StateRunning
+	// Waiting to re-run Fn
+	StateWaiting
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateRunning:
+		return "running"
+	case StateWaiting:
+		return "waiting"
+	default:
+		return "unknown"
+	}
+}
+
+// Status of a guarded function
+type Status struct {
+	// Tag of the guard
+	Tag string
+	// Current state
+	State State
+	// Number of times Fn has been re-run
+	Restarts int
+	// Error returned by the last run of Fn. Nil if succeeded.
+	LastErr error
+	// When Fn was last started
+	LastStart time.Time
+	// When Fn will be re-run. Zero unless State is StateWaiting.
+	NextRetry time.Time
+}
+
+// Create a Guard. Call Run to start guarding.
+func New(cf Conf) *Guard {
 	if cf.Log == nil {
 		cf.Log = log.WithTag("")
 	}
+
+	return &Guard{
+		cf:     cf,
+		status: Status{Tag: cf.Tag},
+	}
+}
+
+// Return the current status.
+func (g *Guard) Status() Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.status
+}
+
+func (g *Guard) update(fn func(st *Status)) {
+	g.mu.Lock()
+	fn(&g.status)
+	st := g.status
+	g.mu.Unlock()
+
+	if g.cf.OnChange != nil {
+		g.cf.OnChange(st)
+	}
+}
+
+// Auto re-run the function until it succeeds (aka, returns nil error) or ctx.Done channel is closed.
+// If AlsoRetryOnSuccess is true, auto re-run the function until ctx.Done channel is closed.
+func (g *Guard) Run(ctx context.Context) {
+	cf := g.cf
 	lg := cf.Log.WithTag("guard " + cf.Tag)
 	lg.Info("starting")
 
+	if cf.Registry != nil {
+		cf.Registry.add(g)
+		defer cf.Registry.remove(g)
+	}
+
+	defer g.update(func(st *Status) {
+		st.State = StateStopped
+		st.NextRetry = time.Time{}
+	})
+
 	bf := backoff.New(cf.Bf)
 
 	timer := time.NewTimer(0)
 	defer timer.Stop()
 
-	for {
+	for runs := 0; ; runs++ {
 		select {
 		case <-ctx.Done():
 			lg.Info("received exit signal, exiting")
@@ -53,7 +155,19 @@ func WithGuard(ctx context.Context, cf Conf) {
 		case <-timer.C:
 		}
 
+		g.update(func(st *Status) {
+			st.State = StateRunning
+			st.Restarts = runs
+			st.LastStart = time.Now()
+			st.NextRetry = time.Time{}
+		})
+
 		err := cf.Fn(ctx)
+
+		g.mu.Lock()
+		g.status.LastErr = err
+		g.mu.Unlock()
+
 		if err == nil && !cf.AlsoRetryOnSuccess {
 			lg.Info("completed")
 			return
@@ -71,6 +185,11 @@ func WithGuard(ctx context.Context, cf Conf) {
 			lg.Warn("re-run in %v", dur)
 		}
 
+		g.update(func(st *Status) {
+			st.State = StateWaiting
+			st.NextRetry = time.Now().Add(dur)
+		})
+
 		timer.Reset(dur)
 	}
 }
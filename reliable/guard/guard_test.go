@@ -96,3 +96,104 @@ func TestRetryOnSuccess(t *testing.T) {
 
 	as.Error(ctx.Err())
 }
+
+func TestStatus(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var states []State
+	var reg Registry
+
+	g := New(Conf{
+		Tag: "dummy",
+		Fn:  failUntil(3),
+		Bf:  bf,
+		OnChange: func(st Status) {
+			states = append(states, st.State)
+		},
+		Registry: &reg,
+	})
+	as.Equal(StateStopped, g.Status().State)
+
+	g.Run(ctx)
+
+	st := g.Status()
+	as.Equal("dummy", st.Tag)
+	as.Equal(StateStopped, st.State)
+	as.Equal(2, st.Restarts)
+	as.Nil(st.LastErr)
+	as.False(st.LastStart.IsZero())
+	as.True(st.NextRetry.IsZero())
+
+	as.Equal([]State{
+		StateRunning, StateWaiting,
+		StateRunning, StateWaiting,
+		StateRunning, StateStopped,
+	}, states)
+
+	as.Empty(reg.Statuses())
+}
+
+func TestRegistry(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reg Registry
+	chWaiting := make(chan struct{}, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		WithGuard(ctx, Conf{
+			Tag: "b",
+			Fn: func(_ context.Context) error {
+				return errDummy
+			},
+			Bf: backoff.Conf{Min: time.Second, Max: time.Second},
+			OnChange: func(st Status) {
+				if st.State == StateWaiting {
+					select {
+					case chWaiting <- struct{}{}:
+					default:
+					}
+				}
+			},
+			Registry: &reg,
+		})
+	}()
+
+	go WithGuard(ctx, Conf{
+		Tag: "a",
+		Fn: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		Registry: &reg,
+	})
+
+	<-chWaiting
+	time.Sleep(time.Millisecond * 10)
+
+	sts := reg.Statuses()
+	as.Len(sts, 2)
+	as.Equal("a", sts[0].Tag)
+	as.Equal(StateRunning, sts[0].State)
+	as.Equal("b", sts[1].Tag)
+	as.Equal(StateWaiting, sts[1].State)
+	as.ErrorIs(sts[1].LastErr, errDummy)
+	as.True(sts[1].NextRetry.After(time.Now()))
+
+	failing := reg.Failing()
+	as.Len(failing, 1)
+	as.Equal("b", failing[0].Tag)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,68 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package guard
+
+import (
+	"sort"
+	"sync"
+)
+
+// Registry of running guards. Commonly used to surface guard statuses in health endpoints.
+// The zero value is ready to use.
+type Registry struct {
+	mu     sync.Mutex
+	guards map[*Guard]struct{}
+}
+
+func (r *Registry) add(g *Guard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.guards == nil {
+		r.guards = make(map[*Guard]struct{})
+	}
+
+	r.guards[g] = struct{}{}
+}
+
+func (r *Registry) remove(g *Guard) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.guards, g)
+}
+
+// Return statuses of all registered guards, sorted by tag.
+func (r *Registry) Statuses() []Status {
+	r.mu.Lock()
+	l := make([]Status, 0, len(r.guards))
+	for g := range r.guards {
+		l = append(l, g.Status())
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(l, func(i, j int) bool {
+		return l[i].Tag < l[j].Tag
+	})
+
+	return l
+}
+
+// Return statuses of registered guards which are waiting to re-run because of errors, sorted by tag.
+func (r *Registry) Failing() []Status {
+	var l []Status
+
+	for _, st := range r.Statuses() {
+		if st.State == StateWaiting && st.LastErr != nil {
+			l = append(l, st)
+		}
+	}
+
+	return l
+}
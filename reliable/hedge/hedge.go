@@ -0,0 +1,123 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+/*
+Hedged requests cut tail latency: if an attempt has not returned after a delay (e.g. the p95 latency), another attempt is started.
+The first success wins, and the rest are cancelled via ctx.
+*/
+package hedge
+
+import (
+	"context"
+	"time"
+)
+
+type Conf struct {
+	// Delay before starting the next attempt, e.g. the p95 latency.
+	// A failed attempt starts the next one at once.
+	Delay time.Duration
+	// Max number of attempts, including the first one. Default to 2.
+	Attempts int
+}
+
+const defAttempts = 2
+
+// Run fn, and start another attempt after each Delay, up to Attempts in total.
+// Return the first success, and cancel the rest via ctx. Return the last error if all attempts fail.
+// fn should return ASAP when ctx.Done channel is closed.
+func Do[O any](ctx context.Context, cf Conf, fn func(ctx context.Context) (O, error)) (O, error) {
+	attempts := cf.Attempts
+	if attempts < 1 {
+		attempts = defAttempts
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffered, so that losers never block.
+	ch := make(chan result[O], attempts)
+	start := func() {
+		go func() {
+			val, err := fn(ctx)
+			ch <- result[O]{val, err}
+		}()
+	}
+
+	start()
+	started, failed := 1, 0
+
+	timer := time.NewTimer(cf.Delay)
+	defer timer.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case r := <-ch:
+			if r.err == nil {
+				return r.val, nil
+			}
+
+			failed++
+			lastErr = r.err
+			if failed == attempts {
+				var out O
+				return out, lastErr
+			}
+
+			// Start the next at once, rather than waiting for the timer.
+			if started < attempts {
+				start()
+				started++
+				resetTimer(timer, cf.Delay)
+			}
+
+		case <-timer.C:
+			if started < attempts {
+				start()
+				started++
+				timer.Reset(cf.Delay)
+			}
+
+		case <-ctx.Done():
+			var out O
+			return out, ctx.Err()
+		}
+	}
+}
+
+type result[T any] struct {
+	val T
+	err error
+}
+
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// Hedging Decorator for functions with input and output parameters, i.e func(ctx, I) (O, error).
+// Composable with the context-aware decorators in reliable/timeouts, e.g. to time out each attempt.
+func WithHedgeIO[I, O any](cf Conf, fn func(context.Context, I) (O, error)) func(context.Context, I) (O, error) {
+	return func(ctx context.Context, in I) (O, error) {
+		return Do(ctx, cf, func(ctx context.Context) (O, error) {
+			return fn(ctx, in)
+		})
+	}
+}
+
+// Hedging Decorator for functions with output parameters only, i.e func(ctx) (O, error)
+func WithHedgeO[O any](cf Conf, fn func(context.Context) (O, error)) func(context.Context) (O, error) {
+	return func(ctx context.Context) (O, error) {
+		return Do(ctx, cf, fn)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/reliable/timeouts"
+)
+
+var errDummy = errors.New("dummy")
+
+func TestDo(t *testing.T) {
+	as := require.New(t)
+	ctx := context.Background()
+	cf := Conf{Delay: time.Millisecond * 10, Attempts: 3}
+
+	// The first attempt is fast enough.
+	var n int32
+	v, err := Do(ctx, cf, func(ctx context.Context) (int32, error) {
+		return atomic.AddInt32(&n, 1), nil
+	})
+	as.Nil(err)
+	as.Equal(int32(1), v)
+	time.Sleep(time.Millisecond * 30)
+	as.Equal(int32(1), atomic.LoadInt32(&n))
+
+	// The first attempt is slow, and the second wins. The loser is cancelled.
+	n = 0
+	cancelled := make(chan struct{})
+	v, err = Do(ctx, cf, func(ctx context.Context) (int32, error) {
+		i := atomic.AddInt32(&n, 1)
+		if i == 1 {
+			<-ctx.Done()
+			close(cancelled)
+			return 0, ctx.Err()
+		}
+		return i, nil
+	})
+	as.Nil(err)
+	as.Equal(int32(2), v)
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		as.Fail("loser not cancelled")
+	}
+
+	// All attempts fail. Failures start the next attempt at once.
+	n = 0
+	start := time.Now()
+	_, err = Do(ctx, Conf{Delay: time.Second, Attempts: 3}, func(ctx context.Context) (int32, error) {
+		atomic.AddInt32(&n, 1)
+		return 0, errDummy
+	})
+	as.ErrorIs(err, errDummy)
+	as.Equal(int32(3), atomic.LoadInt32(&n))
+	as.Less(time.Since(start), time.Millisecond*500)
+
+	// ctx done
+	ctx2, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	_, err = Do(ctx2, cf, func(ctx context.Context) (int32, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	as.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestWithHedge(t *testing.T) {
+	as := require.New(t)
+
+	// Each attempt times out after 20ms. Only the third attempt is fast.
+	var n int32
+	fn := timeouts.WithTimeoutCtxIO(time.Millisecond*20, nil, func(ctx context.Context, in string) (string, error) {
+		if atomic.AddInt32(&n, 1) < 3 {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}
+		return in, nil
+	})
+	fn = WithHedgeIO(Conf{Delay: time.Millisecond * 5, Attempts: 3}, fn)
+
+	v, err := fn(context.Background(), "x")
+	as.Nil(err)
+	as.Equal("x", v)
+}
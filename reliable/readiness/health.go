@@ -0,0 +1,204 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A named health check
+type Check struct {
+	// Name of the check. Must be unique in a Registry.
+	Name string
+	// Healthy if Fn returns nil. ctx is done after Timeout.
+	Fn func(ctx context.Context) error
+	// Timeout of Fn. Default to 3s.
+	Timeout time.Duration
+	// The result of Fn is cached for CacheTTL, so that frequent probes do not overload dependencies.
+	// Default to 0, i.e. no caching.
+	CacheTTL time.Duration
+	// If true, the check is used for both liveness and readiness. Otherwise, only for readiness.
+	Live bool
+}
+
+const defCheckTimeout = time.Second * 3
+
+// Result of a check
+type Result struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Error returned by the check, if unhealthy
+	Error string `json:"error,omitempty"`
+	// When the check was run
+	At time.Time `json:"at"`
+	// How long the check took, in nanoseconds in JSON
+	Took time.Duration `json:"took"`
+}
+
+// Results of a set of checks
+type Report struct {
+	// Healthy if all checks are healthy
+	Healthy bool `json:"healthy"`
+	// "notReady" or "draining" if the application marks the Server so, in which case checks are not run.
+	State  string   `json:"state,omitempty"`
+	Checks []Result `json:"checks"`
+}
+
+// A Registry of health checks, where components register their checks.
+type Registry struct {
+	mu     sync.Mutex
+	checks map[string]*check
+}
+
+// Create a Registry.
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]*check)}
+}
+
+var errNoCheckName = errors.New("check name is empty")
+
+// Register a check.
+func (r *Registry) Register(c Check) error {
+	if c.Name == "" {
+		return errNoCheckName
+	}
+	if c.Fn == nil {
+		return fmt.Errorf("check %v: fn is nil", c.Name)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defCheckTimeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.checks[c.Name]; ok {
+		return fmt.Errorf("duplicate check %v", c.Name)
+	}
+
+	r.checks[c.Name] = &check{Check: c}
+	return nil
+}
+
+// Unregister a check. A no-op if not registered.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.checks, name)
+}
+
+// Run checks concurrently, and return a Report sorted by names.
+// If live is true, only checks for liveness are run.
+func (r *Registry) Check(ctx context.Context, live bool) Report {
+	checks := r.list(live)
+	rep := Report{Healthy: true, Checks: make([]Result, len(checks))}
+
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+
+	for i, c := range checks {
+		go func(i int, c *check) {
+			defer wg.Done()
+			rep.Checks[i] = c.run(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, res := range rep.Checks {
+		if !res.Healthy {
+			rep.Healthy = false
+		}
+	}
+
+	return rep
+}
+
+// Run a check by name. Return false if not found.
+func (r *Registry) CheckOne(ctx context.Context, name string) (Result, bool) {
+	r.mu.Lock()
+	c, ok := r.checks[name]
+	r.mu.Unlock()
+
+	if !ok {
+		return Result{}, false
+	}
+
+	return c.run(ctx), true
+}
+
+func (r *Registry) list(live bool) []*check {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	l := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		if !live || c.Live {
+			l = append(l, c)
+		}
+	}
+
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].Name < l[j].Name
+	})
+	return l
+}
+
+type check struct {
+	Check
+	// Held while Fn is running, so that concurrent probes share a result.
+	mu     sync.Mutex
+	last   Result
+	hasRes bool
+}
+
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hasRes && c.CacheTTL > 0 && time.Since(c.last.At) < c.CacheTTL {
+		return c.last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+
+	res := Result{Name: c.Name, At: time.Now()}
+	err := c.callFn(ctx)
+	res.Took = time.Since(res.At)
+
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Healthy = true
+	}
+
+	c.last, c.hasRes = res, true
+	return res
+}
+
+// Call Fn. Return once ctx is done, even if Fn does not respect ctx.
+func (c *check) callFn(ctx context.Context) error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- c.Fn(ctx)
+	}()
+
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,151 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+)
+
+func TestRegistry(t *testing.T) {
+	as := require.New(t)
+	ctx := context.Background()
+
+	r := NewRegistry()
+	var n int32
+	as.Nil(r.Register(Check{
+		Name: "db",
+		Fn: func(ctx context.Context) error {
+			atomic.AddInt32(&n, 1)
+			return errors.New("unreachable")
+		},
+		CacheTTL: time.Minute,
+	}))
+	as.Nil(r.Register(Check{
+		Name: "loop",
+		Fn:   func(ctx context.Context) error { return nil },
+		Live: true,
+	}))
+	as.Nil(r.Register(Check{
+		Name: "slow",
+		// ignore ctx
+		Fn: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+		Timeout: time.Millisecond * 10,
+	}))
+
+	as.Error(r.Register(Check{Name: "db", Fn: func(ctx context.Context) error { return nil }}))
+	as.Error(r.Register(Check{Fn: func(ctx context.Context) error { return nil }}))
+	as.Error(r.Register(Check{Name: "nil"}))
+
+	rep := r.Check(ctx, false)
+	as.False(rep.Healthy)
+	as.Len(rep.Checks, 3)
+	as.Equal("db", rep.Checks[0].Name)
+	as.Equal("unreachable", rep.Checks[0].Error)
+	as.True(rep.Checks[1].Healthy)
+	as.Equal(context.DeadlineExceeded.Error(), rep.Checks[2].Error)
+	as.Less(rep.Checks[2].Took, time.Millisecond*500)
+
+	// cached
+	r.Check(ctx, false)
+	as.Equal(int32(1), atomic.LoadInt32(&n))
+
+	rep = r.Check(ctx, true)
+	as.True(rep.Healthy)
+	as.Len(rep.Checks, 1)
+
+	res, ok := r.CheckOne(ctx, "loop")
+	as.True(ok)
+	as.True(res.Healthy)
+	_, ok = r.CheckOne(ctx, "none")
+	as.False(ok)
+
+	r.Unregister("db")
+	r.Unregister("slow")
+	as.True(r.Check(ctx, false).Healthy)
+}
+
+func TestHTTP(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const addr = "127.0.0.1:5064"
+
+	var healthy atomic.Value
+	healthy.Store(true)
+
+	r := NewRegistry()
+	as.Nil(r.Register(Check{
+		Name: "db",
+		Fn: func(ctx context.Context) error {
+			if healthy.Load().(bool) {
+				return nil
+			}
+			return errors.New("unreachable")
+		},
+	}))
+
+	done := make(chan error, 1)
+	go func() {
+		s := &Server{Addr: addr, HTTP: true, Registry: r}
+		done <- s.Serve(ctx)
+	}()
+
+	get := func(path string, v any) int {
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			var err error
+			resp, err = http.Get("http://" + addr + path)
+			return err == nil
+		}, time.Second, time.Millisecond*5)
+		defer resp.Body.Close()
+
+		if v != nil {
+			as.Nil(json.NewDecoder(resp.Body).Decode(v))
+		}
+		return resp.StatusCode
+	}
+
+	var rep Report
+	as.Equal(http.StatusOK, get("/readyz", &rep))
+	as.True(rep.Healthy)
+	as.Len(rep.Checks, 1)
+
+	healthy.Store(false)
+	as.Equal(http.StatusServiceUnavailable, get("/readyz", &rep))
+	as.False(rep.Healthy)
+	as.Equal("unreachable", rep.Checks[0].Error)
+
+	var res Result
+	as.Equal(http.StatusServiceUnavailable, get("/readyz/db", &res))
+	as.Equal("db", res.Name)
+	as.Equal(http.StatusNotFound, get("/readyz/none", nil))
+
+	// not a liveness check
+	as.Equal(http.StatusOK, get("/livez", &rep))
+	as.Len(rep.Checks, 0)
+
+	cancel()
+	as.Nil(<-done)
+}
@@ -0,0 +1,116 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// Handle /livez, /readyz and /readyz/<check name>.
+// /readyz is unhealthy while the Server is not ready, regardless of checks.
+// The status code is 200 if healthy, 503 otherwise. The body is the Report or Result in JSON.
+func (s *Server) handler(lg log.TagLogger) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, r *http.Request) {
+		rep := s.registry().Check(r.Context(), true)
+		writeJson(w, rep.Healthy, rep, lg)
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		// Checks are not run if the application marks itself not ready.
+		if !s.Ready() {
+			rep := Report{State: s.st.String(), Checks: []Result{}}
+			writeJson(w, false, rep, lg)
+			return
+		}
+
+		rep := s.registry().Check(r.Context(), false)
+		writeJson(w, rep.Healthy, rep, lg)
+	})
+
+	mux.HandleFunc("/readyz/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/readyz/")
+		res, ok := s.registry().CheckOne(r.Context(), name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		writeJson(w, res.Healthy, res, lg)
+	})
+
+	return mux
+}
+
+func (s *Server) registry() *Registry {
+	if s.Registry == nil {
+		return emptyRegistry
+	}
+	return s.Registry
+}
+
+var emptyRegistry = NewRegistry()
+
+func writeJson(w http.ResponseWriter, healthy bool, v any, lg log.TagLogger) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	if healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		lg.Warn("error writing response: %v", err)
+	}
+}
+
+// Serve HTTP on ln until ctx is done.
+func (s *Server) serveHTTP(ctx context.Context, ln net.Listener, lg log.TagLogger) error {
+	srv := &http.Server{
+		Handler:           s.handler(lg),
+		ReadHeaderTimeout: httpTimeout,
+		WriteTimeout:      httpTimeout * 2,
+	}
+
+	chServe := make(chan error, 1)
+	go func() {
+		chServe <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-chServe:
+		return err
+
+	case <-ctx.Done():
+		lg.Info("received exit signal, exiting")
+
+		ctx, cancel := context.WithTimeout(context.Background(), httpTimeout)
+		defer cancel()
+
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			lg.Warn("error shutting down: %v", err)
+		}
+
+		return nil
+	}
+}
+
+const httpTimeout = time.Second * 5
@@ -16,16 +16,23 @@ import (
 	"github.com/burningxflame/gx/log/log"
 )
 
-// TCP Server for readiness check (aka, health check).
-// Only for connectivity check.
-// For security purpose, no sending data nor receiving data.
+// Server for readiness check (aka, health check).
+// In TCP mode (the default), only for connectivity check. For security purpose, no sending data nor receiving data.
+// In HTTP mode, serve /livez, /readyz and /readyz/<check name> with results of checks in Registry.
+// Ready once listening by default. The application may toggle readiness via SetReady and MarkDraining.
 type Server struct {
 	// The address to listen
 	Addr string
+	// If true, serve HTTP. Otherwise, TCP mode.
+	HTTP bool
+	// Health checks used in HTTP mode. Default to no checks, i.e. always healthy.
+	Registry *Registry
 	// Used to tag log messages. Default to "readiness".
 	Tag string
 	// A TagLogger used to log messages
 	Log log.TagLogger
+
+	st state
 }
 
 // Start the Server.
@@ -39,6 +46,41 @@ func (s *Server) Serve(ctx context.Context) error {
 	}
 	lg := s.Log.WithTag(s.Tag)
 
+	if s.HTTP {
+		ln, err := net.Listen("tcp", s.Addr)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+
+		lg.Info("listening at %v", ln.Addr())
+		return s.serveHTTP(ctx, ln, lg)
+	}
+
+	for {
+		ready, changed := s.st.get()
+		if !ready {
+			lg.Info("%v, not listening", &s.st)
+
+			select {
+			case <-ctx.Done():
+				lg.Info("received exit signal, exiting")
+				return nil
+			case <-changed:
+				continue
+			}
+		}
+
+		err := s.serveTCP(ctx, changed, lg)
+		if err != nil || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// Accept and close conns until ctx is done or readiness changes, i.e. becomes not ready.
+// Stop listening then, so that probes are refused.
+func (s *Server) serveTCP(ctx context.Context, changed <-chan struct{}, lg log.TagLogger) error {
 	ln, err := net.Listen("tcp", s.Addr)
 	if err != nil {
 		return err
@@ -47,21 +89,22 @@ func (s *Server) Serve(ctx context.Context) error {
 
 	lg.Info("listening at %v", ln.Addr())
 
-	go func() {
-		<-ctx.Done()
-		ln.Close()
-		lg.Info("received exit signal, exiting")
-	}()
+	done := make(chan struct{})
+	defer close(done)
 
-	for {
+	go func() {
 		select {
 		case <-ctx.Done():
-			return nil
-		default:
+			lg.Info("received exit signal, exiting")
+		case <-changed:
+		case <-done:
 		}
+		ln.Close()
+	}()
 
+	for {
 		conn, err := ln.Accept()
-		if err != nil && errors.Is(err, net.ErrClosed) { // ln closed, i.e. exiting
+		if err != nil && errors.Is(err, net.ErrClosed) { // ln closed, i.e. exiting or not ready
 			return nil
 		}
 		if err != nil {
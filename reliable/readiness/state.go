@@ -0,0 +1,121 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package readiness
+
+import (
+	"sync"
+	"time"
+)
+
+// Readiness state set by the application. The zero value is ready.
+type state struct {
+	mu       sync.Mutex
+	notReady bool
+	draining bool
+	// closed and replaced on each change
+	changed chan struct{}
+}
+
+// Return whether ready, and a channel closed on the next change.
+func (s *state) get() (bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.changed == nil {
+		s.changed = make(chan struct{})
+	}
+
+	return !s.notReady && !s.draining, s.changed
+}
+
+func (s *state) setReady(ready bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// No effect once draining
+	if s.draining || s.notReady == !ready {
+		return
+	}
+	s.notReady = !ready
+	s.notify()
+}
+
+func (s *state) markDraining() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.draining {
+		return
+	}
+	s.draining = true
+	s.notify()
+}
+
+// Return "draining", "notReady" or "ready".
+func (s *state) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case s.draining:
+		return "draining"
+	case s.notReady:
+		return "notReady"
+	default:
+		return "ready"
+	}
+}
+
+// Must be called with mu held.
+func (s *state) notify() {
+	if s.changed != nil {
+		close(s.changed)
+	}
+	s.changed = make(chan struct{})
+}
+
+// Set whether the Server is ready. E.g. call SetReady(false) before Serve, and SetReady(true) once caches are warm.
+// While not ready, probes are refused in TCP mode, and /readyz returns 503 in HTTP mode.
+// No effect once draining.
+func (s *Server) SetReady(ready bool) {
+	s.st.setReady(ready)
+}
+
+// Mark the Server as draining, i.e. not ready for good, so that no new traffic is routed here.
+// Usually called on exit signal before draining connections.
+// No-op on a nil Server, so that a nil *Server may be used as a Drainer.
+func (s *Server) MarkDraining() {
+	if s == nil {
+		return
+	}
+	s.st.markDraining()
+}
+
+// Return whether the Server is ready, i.e. neither SetReady(false) nor draining.
+func (s *Server) Ready() bool {
+	ready, _ := s.st.get()
+	return ready
+}
+
+// Notified when a server starts draining, e.g. *Server.
+// Used by secure/tcp.Server, secure/http.Server and uds/http.Server.
+type Drainer interface {
+	MarkDraining()
+}
+
+// Mark d as draining, and wait for delay, so that load balancers notice before connections are closed.
+// No-op if d is nil.
+func Drain(d Drainer, delay time.Duration) {
+	if d == nil {
+		return
+	}
+
+	d.MarkDraining()
+	time.Sleep(delay)
+}
@@ -0,0 +1,136 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package readiness
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+)
+
+func TestSetReadyTCP(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const addr = "127.0.0.1:5065"
+
+	s := &Server{Addr: addr}
+	s.SetReady(false)
+	as.False(s.Ready())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+
+	dial := func() error {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// refused until ready
+	time.Sleep(time.Millisecond * 20)
+	as.Error(dial())
+
+	s.SetReady(true)
+	require.Eventually(t, func() bool { return dial() == nil }, time.Second, time.Millisecond*5)
+
+	s.MarkDraining()
+	require.Eventually(t, func() bool { return dial() != nil }, time.Second, time.Millisecond*5)
+
+	// no effect once draining
+	s.SetReady(true)
+	as.False(s.Ready())
+	time.Sleep(time.Millisecond * 20)
+	as.Error(dial())
+
+	cancel()
+	as.Nil(<-done)
+}
+
+func TestSetReadyHTTP(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const addr = "127.0.0.1:5066"
+
+	s := &Server{Addr: addr, HTTP: true}
+	s.SetReady(false)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+
+	get := func(path string) (int, Report) {
+		var resp *http.Response
+		require.Eventually(t, func() bool {
+			var err error
+			resp, err = http.Get("http://" + addr + path)
+			return err == nil
+		}, time.Second, time.Millisecond*5)
+		defer resp.Body.Close()
+
+		var rep Report
+		as.Nil(json.NewDecoder(resp.Body).Decode(&rep))
+		return resp.StatusCode, rep
+	}
+
+	code, rep := get("/readyz")
+	as.Equal(http.StatusServiceUnavailable, code)
+	as.Equal("notReady", rep.State)
+
+	// still alive
+	code, _ = get("/livez")
+	as.Equal(http.StatusOK, code)
+
+	s.SetReady(true)
+	code, rep = get("/readyz")
+	as.Equal(http.StatusOK, code)
+	as.Empty(rep.State)
+
+	s.MarkDraining()
+	code, rep = get("/readyz")
+	as.Equal(http.StatusServiceUnavailable, code)
+	as.Equal("draining", rep.State)
+
+	cancel()
+	as.Nil(<-done)
+}
+
+func TestDrain(t *testing.T) {
+	as := require.New(t)
+
+	s := &Server{}
+	start := time.Now()
+	Drain(s, time.Millisecond*20)
+	as.GreaterOrEqual(time.Since(start), time.Millisecond*20)
+	as.False(s.Ready())
+
+	// no-op
+	Drain(nil, time.Hour)
+	var nilSrv *Server
+	Drain(nilSrv, 0)
+}
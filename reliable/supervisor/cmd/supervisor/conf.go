@@ -10,17 +10,17 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"io/fs"
-	"os"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
-	"sigs.k8s.io/yaml"
-
 	"github.com/burningxflame/gx/log/light"
 	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/log/rotate"
 	"github.com/burningxflame/gx/reliable/backoff"
 	"github.com/burningxflame/gx/reliable/supervisor"
 )
@@ -28,98 +28,359 @@ import (
 type conf struct {
 	Procs []supervisor.Proc
 	Log   light.Conf
+	Ctl   ctlConf
+	// Glob patterns of included files, relative to the dir of the config file
+	Include []string
+}
+
+// Conf of the control API
+type ctlConf struct {
+	// The UDS address to listen. The control API is disabled if empty.
+	UdsAddr string
+	// File permission of the UdsAddr
+	Perm fs.FileMode
 }
 
+// Read and validate a config file. If there are errors, return confErrs including all errors found.
 func readConf(pa string) (conf, error) {
+	cf, errs := loadConf(pa)
+	if len(errs) > 0 {
+		return conf{}, errs
+	}
+
+	return cf, nil
+}
+
+// Load a config file, and return all errors found.
+func loadConf(pa string) (conf, confErrs) {
+	tmp, sources, errs := loadConfJson(pa)
+	if len(errs) > 0 {
+		return conf{}, errs
+	}
+
 	var cf conf
-	var tmp confJson
+	for i, p := range tmp.Procs {
+		src := &sources[i]
+		if src.path != "" {
+			src.path += " "
+		}
+		src.path += fmt.Sprintf("(%v)", p.Tag)
 
-	f, err := os.Open(pa)
-	if err != nil {
-		return cf, err
+		proc, err := p.proc()
+		if err != nil {
+			errs = append(errs, src.wrap(err))
+			continue
+		}
+
+		cf.Procs = append(cf.Procs, proc)
 	}
-	defer f.Close()
 
-	bs, err := io.ReadAll(f)
-	if err != nil {
-		return conf{}, err
+	if len(errs) > 0 {
+		return conf{}, errs
 	}
 
-	err = yaml.Unmarshal(bs, &tmp)
-	if err != nil {
-		return cf, err
-	}
-
-	for _, p := range tmp.Procs {
-		cf.Procs = append(cf.Procs, supervisor.Proc{
-			Tag:  p.Tag,
-			Path: p.Path,
-			Args: p.Args,
-			Bf: backoff.Conf{
-				Min:        time.Millisecond,
-				Max:        p.Bf.Max.Duration,
-				Unit:       p.Bf.Unit.Duration,
-				Strategy:   p.Bf.Strategy.Strategy,
-				ResetAfter: p.Bf.ResetAfter.Duration,
-			},
-		})
+	// errors among procs, e.g. duplicate tags and dependency cycles
+	for _, err := range supervisor.ValidateAll(cf.Procs...) {
+		var pe *supervisor.ProcError
+		if errors.As(err, &pe) {
+			errs = append(errs, sources[pe.Index].wrap(pe.Err))
+			continue
+		}
+
+		errs = append(errs, &pathErr{file: pa, path: "procs", err: err})
+	}
+	if len(errs) > 0 {
+		return conf{}, errs
 	}
 
 	cf.Log = light.Conf{
 		Level:         log.LevelInfo,
-		BufSize:       int(tmp.Log.BufSize) << 10,
+		BufSize:       int(tmp.Log.BufSize.Bytes),
 		FlushInterval: tmp.Log.FlushInterval.Duration,
-		Rc: light.RotateConf{
-			FilePath:   tmp.Log.FilePath,
-			FileSize:   int64(tmp.Log.FileSize) << 20,
-			NBak:       int(tmp.Log.NBak),
-			Perm:       tmp.Log.Perm.FileMode,
-			NoCompress: tmp.Log.NoCompress,
-			Utc:        tmp.Log.Utc,
-		}}
+		Rc:            tmp.Log.rotateConf(),
+	}
+
+	cf.Ctl = ctlConf{
+		UdsAddr: tmp.Ctl.UdsAddr,
+		Perm:    tmp.Ctl.Perm.FileMode,
+	}
+	cf.Include = tmp.Include
 	return cf, nil
 }
 
 type confJson struct {
-	Procs []struct {
-		Tag  string
-		Path string
-		Args []string
-		Bf   struct {
-			Max        duration
-			Unit       duration
-			Strategy   strategy
-			ResetAfter duration
-		}
-	}
-	Log struct {
-		FilePath      string
-		FileSize      uint16
-		NBak          byte
-		Perm          perm
-		NoCompress    bool
-		Utc           bool
-		BufSize       uint16
+	// Version of the config schema. Default to 1.
+	Version int
+	// Glob patterns of files, each of which defines a proc. Relative to the dir of the config file.
+	Include []string
+	Procs   []procJson
+	Log     struct {
+		rotateJson
+		BufSize       kibSize
 		FlushInterval duration
 	}
+	Ctl struct {
+		UdsAddr string
+		Perm    perm
+	}
+}
+
+type procJson struct {
+	Tag  string
+	Path string
+	Args []string
+	Bf   struct {
+		Max        duration
+		Unit       duration
+		Strategy   strategy
+		ResetAfter duration
+	}
+	StopSignal  stopSignal
+	StopTimeout duration
+	Env         []string
+	ClearEnv    bool
+	Dir         string
+	User        string
+	Group       string
+	Umask       *perm
+	Rlimits     []struct {
+		Resource string
+		Soft     uint64
+		Hard     uint64
+	}
+	Output struct {
+		Mode string
+		rotateJson
+	}
+	Health struct {
+		Tcp         string
+		Http        string
+		Exec        []string
+		Interval    duration
+		Timeout     duration
+		StartPeriod duration
+		Threshold   byte
+		Restart     bool
+	}
+	DependsOn []string
+	Mode      string
+	Schedule  string
+	Overlap   string
+}
+
+func (p procJson) proc() (supervisor.Proc, error) {
+	proc := supervisor.Proc{
+		Tag:  p.Tag,
+		Path: p.Path,
+		Args: p.Args,
+		Bf: backoff.Conf{
+			Min:        time.Millisecond,
+			Max:        p.Bf.Max.Duration,
+			Unit:       p.Bf.Unit.Duration,
+			Strategy:   p.Bf.Strategy.Strategy,
+			ResetAfter: p.Bf.ResetAfter.Duration,
+		},
+		StopSignal:  p.StopSignal.Signal,
+		StopTimeout: p.StopTimeout.Duration,
+		Env:         p.Env,
+		ClearEnv:    p.ClearEnv,
+		Dir:         p.Dir,
+		User:        p.User,
+		Group:       p.Group,
+		Health: supervisor.Health{
+			TCP:         p.Health.Tcp,
+			HTTP:        p.Health.Http,
+			Exec:        p.Health.Exec,
+			Interval:    p.Health.Interval.Duration,
+			Timeout:     p.Health.Timeout.Duration,
+			StartPeriod: p.Health.StartPeriod.Duration,
+			Threshold:   int(p.Health.Threshold),
+			Restart:     p.Health.Restart,
+		},
+		DependsOn: p.DependsOn,
+		Schedule:  p.Schedule,
+	}
+
+	switch p.Mode {
+	case "", "daemon":
+	case "oneshot":
+		proc.Mode = supervisor.ModeOneshot
+	case "cron":
+		proc.Mode = supervisor.ModeCron
+	default:
+		return proc, fmt.Errorf("invalid mode %v", p.Mode)
+	}
+
+	switch p.Overlap {
+	case "", "skip":
+	case "queue":
+		proc.Overlap = supervisor.OverlapQueue
+	default:
+		return proc, fmt.Errorf("invalid overlap %v", p.Overlap)
+	}
+
+	switch p.Output.Mode {
+	case "", "none":
+	case "log":
+		proc.Output.Mode = supervisor.OutputLog
+	case "file":
+		proc.Output.Mode = supervisor.OutputFile
+		proc.Output.Rc = p.Output.rotateConf()
+	default:
+		return proc, fmt.Errorf("invalid output mode %v", p.Output.Mode)
+	}
+
+	if p.Umask != nil {
+		proc.Umask = &p.Umask.FileMode
+	}
+
+	for _, l := range p.Rlimits {
+		proc.Rlimits = append(proc.Rlimits, supervisor.Rlimit{
+			Resource: l.Resource,
+			Soft:     l.Soft,
+			Hard:     l.Hard,
+		})
+	}
+
+	return proc, proc.Validate()
+}
+
+type rotateJson struct {
+	FilePath   string
+	FileSize   mibSize
+	NBak       byte
+	Perm       perm
+	NoCompress bool
+	Utc        bool
+}
+
+func (r rotateJson) rotateConf() rotate.Conf {
+	return rotate.Conf{
+		FilePath:   r.FilePath,
+		FileSize:   r.FileSize.Bytes,
+		NBak:       int(r.NBak),
+		Perm:       r.Perm.FileMode,
+		NoCompress: r.NoCompress,
+		Utc:        r.Utc,
+	}
 }
 
+// A duration. Either a Go duration string, e.g. "1m30s", or a number of seconds (deprecated since version 2).
 type duration struct {
 	time.Duration
 }
 
 func (d *duration) UnmarshalJSON(b []byte) error {
-	var tmp byte
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		if v < 0 {
+			return fmt.Errorf("negative duration %v", s)
+		}
+
+		d.Duration = v
+		return nil
+	}
 
+	var tmp uint32
 	err := json.Unmarshal(b, &tmp)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid duration %s", b)
 	}
 
 	d.Duration = time.Duration(tmp) * time.Second
 	return nil
 }
 
+func (*duration) unitful() {}
+
+// A size in bytes. Either a string with a unit, e.g. "10MiB", "512KB" or "100B", or a number in the legacy unit of the field (deprecated since version 2).
+type size struct {
+	Bytes int64
+}
+
+func (s *size) unmarshal(b []byte, legacyUnit int64) error {
+	var str string
+	if json.Unmarshal(b, &str) == nil {
+		v, err := parseSize(str)
+		if err != nil {
+			return err
+		}
+
+		s.Bytes = v
+		return nil
+	}
+
+	var tmp uint32
+	err := json.Unmarshal(b, &tmp)
+	if err != nil {
+		return fmt.Errorf("invalid size %s", b)
+	}
+
+	s.Bytes = int64(tmp) * legacyUnit
+	return nil
+}
+
+func (*size) unitful() {}
+
+var sizeUnits = []struct {
+	suffix string
+	n      int64
+}{
+	// longer suffixes first
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+func parseSize(s string) (int64, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			str = strings.TrimSpace(strings.TrimSuffix(str, u.suffix))
+			unit = u.n
+			break
+		}
+	}
+
+	v, err := strconv.ParseUint(str, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+
+	return int64(v) * unit, nil
+}
+
+// A size whose legacy unit is MiB
+type mibSize struct {
+	size
+}
+
+func (s *mibSize) UnmarshalJSON(b []byte) error {
+	return s.unmarshal(b, 1<<20)
+}
+
+// A size whose legacy unit is KiB
+type kibSize struct {
+	size
+}
+
+func (s *kibSize) UnmarshalJSON(b []byte) error {
+	return s.unmarshal(b, 1<<10)
+}
+
 type strategy struct {
 	backoff.Strategy
 }
@@ -144,6 +405,35 @@ func (s *strategy) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+type stopSignal struct {
+	syscall.Signal
+}
+
+func (s *stopSignal) UnmarshalJSON(b []byte) error {
+	var tmp string
+
+	err := json.Unmarshal(b, &tmp)
+	if err != nil {
+		return err
+	}
+
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(tmp), "SIG")]
+	if !ok {
+		return fmt.Errorf("invalid signal %v", tmp)
+	}
+
+	s.Signal = sig
+	return nil
+}
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"TERM": syscall.SIGTERM,
+}
+
 type perm struct {
 	fs.FileMode
 }
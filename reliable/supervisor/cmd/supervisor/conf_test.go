@@ -9,6 +9,11 @@ Read the LICENSE file for details.
 package main
 
 import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -22,9 +27,9 @@ import (
 
 func TestConf(t *testing.T) {
 	as := require.New(t)
+	t.Setenv("LANG", "")
 
-	actual, err := readConf("testdata/sample_conf.yaml")
-	as.Nil(err)
+	umask := fs.FileMode(0022)
 
 	expect := conf{
 		Procs: []supervisor.Proc{
@@ -39,6 +44,20 @@ func TestConf(t *testing.T) {
 					Strategy:   backoff.Linear,
 					ResetAfter: 10 * time.Second,
 				},
+				StopSignal:  syscall.SIGINT,
+				StopTimeout: 5 * time.Second,
+				Env:         []string{"LANG=C"},
+				Dir:         "/tmp",
+				Umask:       &umask,
+				Output:      supervisor.Output{Mode: supervisor.OutputLog},
+				Health: supervisor.Health{
+					Exec:        []string{"/bin/sh", "-c", "test -f /tmp/xyz/a.txt"},
+					Interval:    10 * time.Second,
+					Timeout:     3 * time.Second,
+					StartPeriod: 5 * time.Second,
+					Threshold:   3,
+					Restart:     true,
+				},
 			},
 			{
 				Tag:  "b",
@@ -51,6 +70,25 @@ func TestConf(t *testing.T) {
 					Strategy:   backoff.Exponent,
 					ResetAfter: 10 * time.Second,
 				},
+				DependsOn: []string{"a"},
+				Output: supervisor.Output{
+					Mode: supervisor.OutputFile,
+					Rc: rotate.Conf{
+						FilePath: "/tmp/xyz/b.log",
+						FileSize: 10 << 20,
+						NBak:     2,
+						Perm:     0600,
+					},
+				},
+			},
+			{
+				Tag:      "c",
+				Path:     "/bin/sh",
+				Args:     []string{"-c", "date >> /tmp/xyz/c.txt"},
+				Bf:       backoff.Conf{Min: time.Millisecond},
+				Mode:     supervisor.ModeCron,
+				Schedule: "*/5 * * * *",
+				Overlap:  supervisor.OverlapQueue,
 			},
 		},
 		Log: light.Conf{
@@ -66,7 +104,179 @@ func TestConf(t *testing.T) {
 				Utc:        false,
 			},
 		},
+		Ctl: ctlConf{
+			UdsAddr: "/tmp/supervisor.sock",
+			Perm:    0600,
+		},
 	}
 
-	as.Equal(expect, actual)
+	for _, pa := range []string{"testdata/sample_conf.yaml", "testdata/legacy_conf.yaml"} {
+		actual, err := readConf(pa)
+		as.Nil(err, pa)
+
+		if pa == "testdata/sample_conf.yaml" {
+			as.Equal([]string{"conf.d/*.yaml"}, actual.Include)
+		}
+		actual.Include = nil
+
+		as.Equal(expect, actual, pa)
+	}
+}
+
+func TestConfErrors(t *testing.T) {
+	as := require.New(t)
+
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		pa := filepath.Join(dir, name)
+		as.Nil(os.MkdirAll(filepath.Dir(pa), 0700))
+		as.Nil(os.WriteFile(pa, []byte(content), 0600))
+		return pa
+	}
+
+	write("conf.d/x.yaml", `
+tag: x
+path: /bin/sh
+stopTimeout: 5
+foo: 1
+`)
+	pa := write("conf.yaml", `
+version: 2
+include: [conf.d/*.yaml]
+procs:
+  - tag: a
+    path: ${SUPERVISOR_TEST_UNSET}
+    bf:
+      max: 10
+      unit: 1x
+    stopSignal: FOO
+    helath: {}
+  - tag: b
+    path: /bin/sh
+    args: abc
+log:
+  fileSize: 10XB
+  bufSize: "1KiB"
+`)
+
+	_, errs := loadConf(pa)
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, strings.TrimPrefix(err.Error(), dir+"/"))
+	}
+
+	as.ElementsMatch([]string{
+		`conf.yaml: procs[0].path: env var SUPERVISOR_TEST_UNSET is not set`,
+		`conf.yaml: procs[0].bf.max: bare number 10 not allowed since version 2, use a string with unit, e.g. "10s" or "10MiB"`,
+		`conf.yaml: procs[0].bf.unit: time: unknown unit "x" in duration "1x"`,
+		`conf.yaml: procs[0].helath: unknown field`,
+		`conf.yaml: procs[0].stopSignal: invalid signal FOO`,
+		`conf.yaml: procs[1].args: expect a list`,
+		`conf.yaml: log.fileSize: invalid size "10XB"`,
+		`conf.d/x.yaml: foo: unknown field`,
+		`conf.d/x.yaml: stopTimeout: bare number 5 not allowed since version 2, use a string with unit, e.g. "10s" or "10MiB"`,
+	}, msgs)
+
+	pa = write("conf.yaml", `
+version: 3
+`)
+	_, errs = loadConf(pa)
+	as.Len(errs, 1)
+	as.ErrorContains(errs[0], "unsupported version 3")
+
+	// semantic errors of procs are reported with tags
+	pa = write("conf.yaml", `
+procs:
+  - tag: a
+    path: /bin/sh
+    mode: foo
+  - tag: b
+    path: ""
+`)
+	_, errs = loadConf(pa)
+	as.Len(errs, 2)
+	as.ErrorContains(errs[0], "procs[0] (a): invalid mode foo")
+	as.ErrorContains(errs[1], "procs[1] (b): empty command")
+
+	// errors among procs are all reported with paths
+	write("conf.d/x.yaml", `
+tag: x
+path: /bin/sh
+dependsOn: [w]
+`)
+	write("conf.d/w.yaml", `
+tag: w
+path: /bin/sh
+dependsOn: [x]
+`)
+	pa = write("conf.yaml", `
+include: [conf.d/*.yaml]
+procs:
+  - tag: a
+    path: /bin/sh
+    dependsOn: [z]
+  - tag: a
+    path: /bin/sh
+`)
+	_, errs = loadConf(pa)
+	msgs = nil
+	for _, err := range errs {
+		msgs = append(msgs, strings.TrimPrefix(err.Error(), dir+"/"))
+	}
+	as.Equal([]string{
+		`conf.yaml: procs[0] (a): proc a depends on unknown proc z`,
+		`conf.yaml: procs[1] (a): duplicate tag a`,
+		`conf.d/w.yaml: (w): dependency cycle involving proc w`,
+	}, msgs)
+}
+
+func TestExpandEnv(t *testing.T) {
+	as := require.New(t)
+	t.Setenv("SUPERVISOR_TEST_VAR", "v")
+	t.Setenv("SUPERVISOR_TEST_EMPTY", "")
+
+	tcs := []struct {
+		in, out string
+	}{
+		{"abc", "abc"},
+		{"a${SUPERVISOR_TEST_VAR}b", "avb"},
+		{"${SUPERVISOR_TEST_EMPTY:-d}", "d"},
+		{"${SUPERVISOR_TEST_EMPTY}", ""},
+		{"$$HOME $HOME $", "$HOME $HOME $"},
+	}
+	for _, tc := range tcs {
+		out, err := expandEnv(tc.in)
+		as.Nil(err, tc.in)
+		as.Equal(tc.out, out, tc.in)
+	}
+
+	for _, in := range []string{"${", "${}", "${SUPERVISOR_TEST_UNSET_VAR}"} {
+		_, err := expandEnv(in)
+		as.Error(err, in)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	as := require.New(t)
+
+	tcs := map[string]int64{
+		"100":    100,
+		"100B":   100,
+		"2KiB":   2 << 10,
+		"10 MiB": 10 << 20,
+		"1GiB":   1 << 30,
+		"3kb":    3000,
+		"5MB":    5e6,
+		"4M":     4 << 20,
+	}
+	for in, expect := range tcs {
+		v, err := parseSize(in)
+		as.Nil(err, in)
+		as.Equal(expect, v, in)
+	}
+
+	for _, in := range []string{"", "MiB", "-1KiB", "1.5MiB", "1TiB"} {
+		_, err := parseSize(in)
+		as.Error(err, in)
+	}
 }
@@ -0,0 +1,435 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Supported versions of the config schema:
+//
+//	1: the default. Durations and sizes may be numbers in legacy units, i.e. seconds, MiB or KiB.
+//	2: durations and sizes must be strings with units, e.g. "10s" or "10MiB".
+//	   ${VAR} and ${VAR:-default} in string values are replaced with env vars. $$ is an escaped $.
+const (
+	minVersion = 1
+	maxVersion = 2
+)
+
+// An error at a path of a config file
+type pathErr struct {
+	file string
+	path string
+	err  error
+}
+
+func (e *pathErr) Error() string {
+	var parts []string
+	for _, s := range []string{e.file, e.path} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	return strings.Join(append(parts, e.err.Error()), ": ")
+}
+
+func (e *pathErr) Unwrap() error {
+	return e.err
+}
+
+func (e pathErr) wrap(err error) error {
+	e.err = err
+	return &e
+}
+
+// All errors found in a config file
+type confErrs []error
+
+func (e confErrs) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "\n")
+}
+
+// Load the config file and included files into confJson.
+// Also return the source of each proc, i.e. the file and path where it's defined.
+func loadConfJson(pa string) (confJson, []pathErr, confErrs) {
+	var cj confJson
+	var errs confErrs
+
+	root, err := readTree(pa)
+	if err != nil {
+		return cj, nil, confErrs{&pathErr{file: pa, err: err}}
+	}
+
+	m, ok := root.(map[string]any)
+	if !ok && root != nil {
+		return cj, nil, confErrs{&pathErr{file: pa, err: errors.New("expect a mapping")}}
+	}
+	if m == nil {
+		m = make(map[string]any)
+	}
+
+	version, err := parseVersion(m["version"])
+	if err != nil {
+		return cj, nil, confErrs{&pathErr{file: pa, path: "version", err: err}}
+	}
+
+	c := checker{file: pa, version: version}
+	c.expandEnv(m, "")
+	c.check(m, reflect.TypeOf(cj), "")
+
+	procs, _ := m["procs"].([]any)
+	var sources []pathErr
+	for i := range procs {
+		sources = append(sources, pathErr{file: pa, path: fmt.Sprintf("procs[%v]", i)})
+	}
+
+	includes, err := includedFiles(pa, m["include"])
+	if err != nil {
+		c.errs = append(c.errs, &pathErr{file: pa, path: "include", err: err})
+	}
+
+	procType := reflect.TypeOf(procJson{})
+	for _, file := range includes {
+		proc, err := readTree(file)
+		if err != nil {
+			c.errs = append(c.errs, &pathErr{file: file, err: err})
+			continue
+		}
+
+		ic := checker{file: file, version: version}
+		ic.expandEnv(proc, "")
+		ic.check(proc, procType, "")
+		c.errs = append(c.errs, ic.errs...)
+
+		procs = append(procs, proc)
+		sources = append(sources, pathErr{file: file})
+	}
+
+	errs = c.errs
+	if len(errs) > 0 {
+		return cj, nil, errs
+	}
+
+	m["procs"] = procs
+	err = decodeTree(m, &cj)
+	if err != nil {
+		return cj, nil, confErrs{&pathErr{file: pa, err: err}}
+	}
+
+	return cj, sources, nil
+}
+
+// Read a YAML file into a tree of map[string]any, []any, string, json.Number, bool and nil.
+func readTree(pa string) (any, error) {
+	bs, err := os.ReadFile(pa)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := yaml.YAMLToJSON(bs)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var tree any
+	err = dec.Decode(&tree)
+	return tree, err
+}
+
+func decodeTree(tree any, v any) error {
+	bs, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(bs, v)
+}
+
+func parseVersion(v any) (int, error) {
+	if v == nil {
+		return minVersion, nil
+	}
+
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid version %v", v)
+	}
+
+	i, err := n.Int64()
+	if err != nil || i < minVersion || i > maxVersion {
+		return 0, fmt.Errorf("unsupported version %v, should be in [%v, %v]", n, minVersion, maxVersion)
+	}
+
+	return int(i), nil
+}
+
+// Return files matched by the include patterns, sorted and deduplicated.
+func includedFiles(pa string, v any) ([]string, error) {
+	// Type errors are reported by checker.
+	var patterns []string
+	_ = decodeTree(v, &patterns)
+
+	dir := filepath.Dir(pa)
+	seen := make(map[string]struct{})
+	var files []string
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %v: %w", pattern, err)
+		}
+
+		for _, f := range matches {
+			if _, ok := seen[f]; ok {
+				continue
+			}
+			seen[f] = struct{}{}
+			files = append(files, f)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// Check a tree against a type, and collect errors with paths.
+type checker struct {
+	file    string
+	version int
+	errs    confErrs
+}
+
+func (c *checker) addErr(path string, err error) {
+	c.errs = append(c.errs, &pathErr{file: c.file, path: path, err: err})
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	unitfulType     = reflect.TypeOf((*interface{ unitful() })(nil)).Elem()
+)
+
+func (c *checker) check(v any, t reflect.Type, path string) {
+	if v == nil {
+		return
+	}
+
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		if _, ok := v.(json.Number); ok && c.version >= 2 && reflect.PtrTo(t).Implements(unitfulType) {
+			c.addErr(path, fmt.Errorf(`bare number %v not allowed since version 2, use a string with unit, e.g. "10s" or "10MiB"`, v))
+			return
+		}
+
+		c.decode(v, t, path)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		c.check(v, t.Elem(), path)
+
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			c.addErr(path, errors.New("expect a mapping"))
+			return
+		}
+
+		fields := jsonFields(t)
+		for _, k := range sortedKeys(m) {
+			ft, ok := lookupField(fields, k)
+			if !ok {
+				c.addErr(join(path, k), errors.New("unknown field"))
+				continue
+			}
+
+			c.check(m[k], ft, join(path, k))
+		}
+
+	case reflect.Slice:
+		l, ok := v.([]any)
+		if !ok {
+			c.addErr(path, errors.New("expect a list"))
+			return
+		}
+
+		for i, e := range l {
+			c.check(e, t.Elem(), fmt.Sprintf("%v[%v]", path, i))
+		}
+
+	default:
+		c.decode(v, t, path)
+	}
+}
+
+func (c *checker) decode(v any, t reflect.Type, path string) {
+	err := decodeTree(v, reflect.New(t).Interface())
+	if err != nil {
+		var te *json.UnmarshalTypeError
+		if errors.As(err, &te) {
+			err = fmt.Errorf("cannot use %v as %v", te.Value, te.Type)
+		}
+
+		c.addErr(path, err)
+	}
+}
+
+// Replace ${VAR} and ${VAR:-default} in string values with env vars, since version 2.
+func (c *checker) expandEnv(v any, path string) {
+	if c.version < 2 {
+		return
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		for _, k := range sortedKeys(v) {
+			if s, ok := v[k].(string); ok {
+				v[k] = c.expandStr(s, join(path, k))
+			} else {
+				c.expandEnv(v[k], join(path, k))
+			}
+		}
+
+	case []any:
+		for i, e := range v {
+			p := fmt.Sprintf("%v[%v]", path, i)
+			if s, ok := e.(string); ok {
+				v[i] = c.expandStr(s, p)
+			} else {
+				c.expandEnv(e, p)
+			}
+		}
+	}
+}
+
+func (c *checker) expandStr(s, path string) string {
+	r, err := expandEnv(s)
+	if err != nil {
+		c.addErr(path, err)
+		return s
+	}
+
+	return r
+}
+
+func expandEnv(s string) (string, error) {
+	var b strings.Builder
+
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+
+		b.WriteString(s[:i])
+		s = s[i+1:]
+
+		switch s[0] {
+		case '$':
+			b.WriteByte('$')
+			s = s[1:]
+
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return "", errors.New("unclosed ${")
+			}
+
+			expr := s[1:end]
+			s = s[end+1:]
+
+			name, def, hasDef := strings.Cut(expr, ":-")
+			if name == "" {
+				return "", errors.New("empty env var name in ${}")
+			}
+
+			val, ok := os.LookupEnv(name)
+			if !ok || (hasDef && val == "") {
+				if !hasDef {
+					return "", fmt.Errorf("env var %v is not set", name)
+				}
+				val = def
+			}
+			b.WriteString(val)
+
+		default:
+			b.WriteByte('$')
+		}
+	}
+}
+
+// Exported fields of a struct, including promoted fields of embedded structs, keyed by lowercase name.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for k, ft := range jsonFields(f.Type) {
+				if _, ok := fields[k]; !ok {
+					fields[k] = ft
+				}
+			}
+			continue
+		}
+
+		if f.IsExported() {
+			fields[strings.ToLower(f.Name)] = f.Type
+		}
+	}
+
+	return fields
+}
+
+func lookupField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	t, ok := fields[strings.ToLower(key)]
+	return t, ok
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
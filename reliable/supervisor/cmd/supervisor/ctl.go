@@ -0,0 +1,297 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/burningxflame/gx/reliable/supervisor"
+	uh "github.com/burningxflame/gx/uds/http"
+)
+
+// Control API over UDS:
+//
+//	GET  /procs                    statuses of all procs
+//	POST /procs/<tag>/start        start a proc
+//	POST /procs/<tag>/stop         stop a proc
+//	POST /procs/<tag>/restart      restart a proc
+//	GET  /procs/<tag>/tail?n=<n>   the last n lines of output of a proc
+func ctlHandler(g *supervisor.Group) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(r.URL.Path, "/")
+		parts := strings.Split(path, "/")
+
+		if len(parts) < 1 || parts[0] != "procs" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if len(parts) == 1 {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			writeJson(w, toProcStatuses(g.Status()))
+			return
+		}
+
+		if len(parts) != 3 {
+			http.NotFound(w, r)
+			return
+		}
+
+		tag, action := parts[1], parts[2]
+
+		if action == "tail" {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			n, err := strconv.Atoi(r.URL.Query().Get("n"))
+			if err != nil || n < 1 {
+				n = defTailLines
+			}
+
+			lines, err := g.Tail(tag, n)
+			if err != nil {
+				writeErr(w, err)
+				return
+			}
+
+			for _, line := range lines {
+				fmt.Fprintln(w, line)
+			}
+			return
+		}
+
+		var fn func(string) error
+		switch action {
+		case "start":
+			fn = g.Start
+		case "stop":
+			fn = g.Stop
+		case "restart":
+			fn = g.Restart
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		err := fn(tag)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+const defTailLines = 20
+
+// Status of a proc in JSON
+type procStatus struct {
+	Tag       string
+	State     string
+	Pid       int
+	Healthy   bool
+	Restarts  int
+	LastErr   string
+	LastStart time.Time
+	NextRetry time.Time
+}
+
+func toProcStatuses(l []supervisor.ProcStatus) []procStatus {
+	r := make([]procStatus, 0, len(l))
+
+	for _, st := range l {
+		var lastErr string
+		if st.LastErr != nil {
+			lastErr = st.LastErr.Error()
+		}
+
+		r = append(r, procStatus{
+			Tag:       st.Tag,
+			State:     st.State.String(),
+			Pid:       st.Pid,
+			Healthy:   st.Healthy,
+			Restarts:  st.Restarts,
+			LastErr:   lastErr,
+			LastStart: st.LastStart,
+			NextRetry: st.NextRetry,
+		})
+	}
+
+	return r
+}
+
+func writeJson(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeErr(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	if errors.Is(err, supervisor.ErrNoSuchProc) {
+		code = http.StatusNotFound
+	}
+
+	http.Error(w, err.Error(), code)
+}
+
+const defCtlAddr = "/tmp/supervisor.sock"
+
+const ctlUsage = `usage: supervisor ctl [-s <udsAddr>] <command> [<tag>]
+
+commands:
+  status               show statuses of all procs
+  start <tag>          start a proc
+  stop <tag>           stop a proc
+  restart <tag>        restart a proc
+  tail [-n N] <tag>    show the last N lines of output of a proc
+`
+
+// Talk to the control API of a running supervisor.
+func ctl(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), ctlUsage)
+	}
+	addr := fs.String("s", defCtlAddr, "UDS address of the control API")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	args = fs.Args()
+	if len(args) < 1 {
+		fs.Usage()
+		return errCtlUsage
+	}
+
+	c := uh.NewClient(*addr)
+	c.Timeout = time.Minute
+
+	switch cmd := args[0]; cmd {
+	case "status":
+		var l []procStatus
+		err := ctlDo(c, http.MethodGet, "/procs", func(body io.Reader) error {
+			return json.NewDecoder(body).Decode(&l)
+		})
+		if err != nil {
+			return err
+		}
+
+		printStatuses(stdout, l)
+		return nil
+
+	case "start", "stop", "restart":
+		if len(args) != 2 {
+			fs.Usage()
+			return errCtlUsage
+		}
+
+		return ctlDo(c, http.MethodPost, "/procs/"+args[1]+"/"+cmd, func(body io.Reader) error {
+			_, err := io.Copy(stdout, body)
+			return err
+		})
+
+	case "tail":
+		tfs := flag.NewFlagSet("tail", flag.ContinueOnError)
+		n := tfs.Int("n", defTailLines, "number of lines")
+		err := tfs.Parse(args[1:])
+		if err != nil {
+			return err
+		}
+		if tfs.NArg() != 1 {
+			fs.Usage()
+			return errCtlUsage
+		}
+
+		path := fmt.Sprintf("/procs/%v/tail?n=%v", tfs.Arg(0), *n)
+		return ctlDo(c, http.MethodGet, path, func(body io.Reader) error {
+			_, err := io.Copy(stdout, body)
+			return err
+		})
+
+	default:
+		fs.Usage()
+		return errCtlUsage
+	}
+}
+
+var errCtlUsage = errors.New("invalid usage")
+
+func ctlDo(c *http.Client, method, path string, handleBody func(io.Reader) error) error {
+	req, err := http.NewRequest(method, "http://unix"+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return handleBody(resp.Body)
+}
+
+func printStatuses(w io.Writer, l []procStatus) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "TAG\tSTATE\tPID\tHEALTHY\tRESTARTS\tLAST START\tLAST ERROR")
+	for _, st := range l {
+		pid := "-"
+		if st.Pid > 0 {
+			pid = strconv.Itoa(st.Pid)
+		}
+
+		lastStart := "-"
+		if !st.LastStart.IsZero() {
+			lastStart = st.LastStart.Local().Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", st.Tag, st.State, pid, st.Healthy, st.Restarts, lastStart, st.LastErr)
+	}
+}
+
+func ctlMain(args []string) {
+	err := ctl(args, os.Stdout)
+	if err != nil {
+		if !errors.Is(err, errCtlUsage) && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/supervisor"
+	uh "github.com/burningxflame/gx/uds/http"
+)
+
+func TestCtl(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	g, err := supervisor.NewGroup(
+		supervisor.Proc{Tag: "a", Path: "/bin/sh", Args: []string{"-c", "echo hello; sleep 10"}},
+	)
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go g.Run(ctx)
+
+	addr := filepath.Join(t.TempDir(), "ctl.sock")
+	s := &uh.Server{
+		Std:     http.Server{Handler: ctlHandler(g)},
+		UdsAddr: addr,
+	}
+	go s.Serve(ctx)
+
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := ctl(append([]string{"-s", addr}, args...), &out)
+		return out.String(), err
+	}
+
+	as.Eventually(func() bool {
+		out, err := run("tail", "a")
+		return err == nil && out == "hello\n"
+	}, time.Second, time.Millisecond*10)
+
+	out, err := run("status")
+	as.Nil(err)
+	as.Contains(out, "TAG")
+	as.Contains(strings.Split(out, "\n")[1], "running")
+
+	out, err = run("stop", "a")
+	as.Nil(err)
+	as.Equal("ok\n", out)
+
+	out, err = run("status")
+	as.Nil(err)
+	as.Contains(strings.Split(out, "\n")[1], "stopped")
+
+	_, err = run("restart", "a")
+	as.Nil(err)
+
+	_, err = run("restart", "b")
+	as.ErrorContains(err, "404")
+
+	_, err = run("bogus")
+	as.ErrorIs(err, errCtlUsage)
+}
@@ -10,22 +10,40 @@ package main
 
 import (
 	"context"
+	"fmt"
 	stdlog "log"
+	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
+	"time"
 
 	"github.com/burningxflame/gx/log/light"
 	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/autoreload"
 	"github.com/burningxflame/gx/reliable/backoff"
 	"github.com/burningxflame/gx/reliable/guard"
 	"github.com/burningxflame/gx/reliable/supervisor"
+	uh "github.com/burningxflame/gx/uds/http"
 )
 
 func main() {
 	args := os.Args[1:]
 	if len(args) < 1 {
-		stdlog.Fatal("usage: supervisor <config.json>")
+		stdlog.Fatal(usage)
+	}
+
+	switch args[0] {
+	case "ctl":
+		ctlMain(args[1:])
+		return
+	case "validate":
+		if len(args) != 2 {
+			stdlog.Fatal(usage)
+		}
+		validateMain(args[1])
+		return
 	}
 
 	c, err := readConf(args[0])
@@ -39,10 +57,109 @@ func main() {
 	initLog(ctx, c.Log)
 	defer log.Close()
 
-	err = supervisor.Supervisor(ctx, c.Procs...)
+	g, err := supervisor.NewGroup(c.Procs...)
 	if err != nil {
 		stdlog.Fatal(err)
 	}
+
+	if c.Ctl.UdsAddr != "" {
+		go serveCtl(ctx, g, c.Ctl)
+	}
+
+	go autoReload(ctx, g, args[0], c.Include)
+	go reloadOnSighup(ctx, g, args[0])
+
+	err = g.Run(ctx)
+	if err != nil {
+		stdlog.Fatal(err)
+	}
+}
+
+// Watch the config file and included files, and reconcile procs on changes.
+// Changes of other sections, including include patterns, take effect only after restart.
+func autoReload(ctx context.Context, g *supervisor.Group, path string, include []string) {
+	autoreload.WithAutoReload(ctx, autoreload.Conf[conf]{
+		Tag:   "conf",
+		Path:  path,
+		Watch: include,
+		Load:  readConf,
+		// Only changes of procs take effect.
+		Equal: func(a, b conf) bool {
+			return reflect.DeepEqual(a.Procs, b.Procs)
+		},
+		Process: func(ctx context.Context, c conf) {
+			reconcile(g, c.Procs)
+			<-ctx.Done()
+		},
+		Bf: backoff.Default(),
+	})
+}
+
+// Reload the config file and reconcile procs on SIGHUP.
+func reloadOnSighup(ctx context.Context, g *supervisor.Group, path string) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ch:
+		}
+
+		log.Info("received SIGHUP, reloading %v", path)
+
+		c, err := readConf(path)
+		if err != nil {
+			log.Error("error reading config: %v", err)
+			continue
+		}
+
+		reconcile(g, c.Procs)
+	}
+}
+
+func reconcile(g *supervisor.Group, procs []supervisor.Proc) {
+	err := g.Reconcile(procs...)
+	if err != nil {
+		log.Error("error reconciling procs: %v", err)
+	}
+}
+
+func serveCtl(ctx context.Context, g *supervisor.Group, cf ctlConf) {
+	guard.WithGuard(ctx, guard.Conf{
+		Tag: "ctl",
+		Fn: func(ctx context.Context) error {
+			s := &uh.Server{
+				Std:             http.Server{Handler: ctlHandler(g)},
+				UdsAddr:         cf.UdsAddr,
+				Perm:            cf.Perm,
+				ShutdownTimeout: time.Second * 5,
+				Tag:             "ctl",
+			}
+			return s.Serve(ctx)
+		},
+		Bf: backoff.Default(),
+	})
+}
+
+const usage = `usage:
+  supervisor <config.yaml>            run the supervisor
+  supervisor validate <config.yaml>   validate a config file, and report all errors
+  supervisor ctl <command>            control a running supervisor`
+
+// Validate a config file, print all errors found, and exit with 1 if any.
+func validateMain(pa string) {
+	c, errs := loadConf(pa)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+
+	fmt.Printf("ok, %v procs\n", len(c.Procs))
 }
 
 func initLog(ctx context.Context, conf light.Conf) {
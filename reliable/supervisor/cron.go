@@ -0,0 +1,199 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A cron schedule. Each field is a bitset of matched values.
+type schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether dom or dow is *. If both are restricted, a day matches if either matches.
+	domStar, dowStar bool
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	monthNames = map[string]uint{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	dowNames = map[string]uint{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+// Parse a standard 5-field cron expression, i.e. minute hour day-of-month month day-of-week,
+// or one of the descriptors @yearly, @annually, @monthly, @weekly, @daily, @midnight and @hourly.
+// A field is a comma-separated list of *, a value or a range a-b, each optionally followed by /step.
+// Month and day-of-week also accept 3-letter names. Day-of-week 7 is Sunday.
+func parseSchedule(expr string) (schedule, error) {
+	var s schedule
+
+	expr = strings.TrimSpace(expr)
+	if d, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = d
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return s, fmt.Errorf("invalid schedule %q: expect 5 fields, got %v", expr, len(fields))
+	}
+
+	var err error
+	parse := func(dst *uint64, field string, min, max uint, names map[string]uint) {
+		if err != nil {
+			return
+		}
+		*dst, err = parseField(field, min, max, names)
+		if err != nil {
+			err = fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+	}
+
+	parse(&s.minute, fields[0], 0, 59, nil)
+	parse(&s.hour, fields[1], 0, 23, nil)
+	parse(&s.dom, fields[2], 1, 31, nil)
+	parse(&s.month, fields[3], 1, 12, monthNames)
+	parse(&s.dow, fields[4], 0, 7, dowNames)
+	if err != nil {
+		return s, err
+	}
+
+	// 7 is Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	s.domStar = fields[2] == "*" || fields[2] == "?"
+	s.dowStar = fields[4] == "*" || fields[4] == "?"
+	return s, nil
+}
+
+func parseField(field string, min, max uint, names map[string]uint) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+
+		step := uint(1)
+		if hasStep {
+			v, err := strconv.ParseUint(stepStr, 10, 8)
+			if err != nil || v < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = uint(v)
+		}
+
+		var lo, hi uint
+		switch {
+		case rng == "*" || rng == "?":
+			lo, hi = min, max
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			lo, err = parseValue(a, names)
+			if err != nil {
+				return 0, err
+			}
+			hi, err = parseValue(b, names)
+			if err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseValue(rng, names)
+			if err != nil {
+				return 0, err
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = max
+			}
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%v, %v]", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(s string, names map[string]uint) (uint, error) {
+	if v, ok := names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.ParseUint(s, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	return uint(v), nil
+}
+
+// Return the first matched time after t, or zero time if none is found in 5 years.
+func (s schedule) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s schedule) dayMatches(t time.Time) bool {
+	domOk := s.dom&(1<<uint(t.Day())) != 0
+	dowOk := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domOk && dowOk
+	}
+
+	return domOk || dowOk
+}
@@ -0,0 +1,578 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/guard"
+)
+
+// Group of supervised processes, which can be controlled at runtime, e.g. stop or restart a single process.
+type Group struct {
+	mu       sync.Mutex
+	children map[string]*child
+	tags     []string // in order of procs
+	ctx      context.Context
+	wg       sync.WaitGroup
+
+	// serialize reconciliations
+	reconcileMu sync.Mutex
+
+	// closed and replaced when health of any process changes
+	healthMu sync.Mutex
+	healthCh chan struct{}
+
+	lg log.TagLogger
+}
+
+// A supervised process
+type child struct {
+	// first field, in order to be 64-bit aligned for atomic operations
+	pid int64
+
+	Proc
+	out *output
+
+	// serialize start and stop
+	ctlMu sync.Mutex
+
+	g *Group
+
+	mu      sync.Mutex
+	guard   *guard.Guard
+	cancel  context.CancelFunc
+	done    chan struct{}
+	healthy bool
+}
+
+// Status of a supervised process
+type ProcStatus struct {
+	guard.Status
+	// Pid of the running process. 0 if not running.
+	Pid int
+	// Whether the process passes its health check
+	Healthy bool
+}
+
+var (
+	ErrNoSuchProc     = errors.New("no such proc")
+	ErrNotRunning     = errors.New("group not running")
+	errAlreadyRunning = errors.New("group already running")
+)
+
+// Create a Group of processes. Tags of processes must be unique.
+func NewGroup(procs ...Proc) (*Group, error) {
+	err := validateProcs(procs)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Group{
+		children: make(map[string]*child, len(procs)),
+		lg:       log.WithTag("supervisor"),
+		healthCh: make(chan struct{}),
+	}
+
+	for _, proc := range procs {
+		g.children[proc.Tag] = &child{Proc: proc, g: g}
+		g.tags = append(g.tags, proc.Tag)
+	}
+
+	return g, nil
+}
+
+func validateProcs(procs []Proc) error {
+	errs := validateAll(procs)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// Validate procs as a group, and return all errors found, ordered by proc index.
+func validateAll(procs []Proc) []error {
+	if len(procs) < 1 {
+		return []error{errNoProc}
+	}
+
+	errsOf := make([][]error, len(procs))
+	add := func(i int, err error) {
+		errsOf[i] = append(errsOf[i], &ProcError{Index: i, Tag: procs[i].Tag, Err: err})
+	}
+
+	byTag := make(map[string]int, len(procs))
+	for i, proc := range procs {
+		err := proc.Validate()
+		if err != nil {
+			add(i, err)
+		}
+
+		if _, ok := byTag[proc.Tag]; ok {
+			add(i, fmt.Errorf("duplicate tag %v", proc.Tag))
+			continue
+		}
+		byTag[proc.Tag] = i
+	}
+
+	for i, proc := range procs {
+		for _, dep := range proc.DependsOn {
+			if _, ok := byTag[dep]; !ok {
+				add(i, fmt.Errorf("proc %v depends on unknown proc %v", proc.Tag, dep))
+			}
+		}
+	}
+
+	for _, i := range findCycles(procs, byTag) {
+		add(i, fmt.Errorf("dependency cycle involving proc %v", procs[i].Tag))
+	}
+
+	var errs []error
+	for _, es := range errsOf {
+		errs = append(errs, es...)
+	}
+	return errs
+}
+
+// Return indexes of procs at which dependency cycles are found, without duplicates.
+// Unknown dependencies are ignored.
+func findCycles(procs []Proc, byTag map[string]int) []int {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[int]int, len(byTag))
+	var found []int
+	seen := make(map[int]bool)
+
+	var visit func(i int)
+	visit = func(i int) {
+		marks[i] = visiting
+		for _, dep := range procs[i].DependsOn {
+			j, ok := byTag[dep]
+			if !ok {
+				continue
+			}
+
+			switch marks[j] {
+			case visiting:
+				if !seen[j] {
+					seen[j] = true
+					found = append(found, j)
+				}
+			case 0:
+				visit(j)
+			}
+		}
+		marks[i] = visited
+	}
+
+	// in the order of procs, so that errors are deterministic
+	for i := range procs {
+		if j, ok := byTag[procs[i].Tag]; ok && j == i && marks[i] == 0 {
+			visit(i)
+		}
+	}
+
+	return found
+}
+
+// Start and guard processes until ctx.Done channel is closed.
+func (g *Group) Run(ctx context.Context) error {
+	g.mu.Lock()
+	if g.ctx != nil {
+		g.mu.Unlock()
+		return errAlreadyRunning
+	}
+
+	for _, tag := range g.tags {
+		c := g.children[tag]
+		if c.out != nil {
+			continue
+		}
+
+		out, err := openOutput(c.Proc)
+		if err != nil {
+			g.closeOutputs()
+			g.mu.Unlock()
+			return err
+		}
+		c.out = out
+	}
+
+	g.ctx = ctx
+	for _, tag := range g.tags {
+		g.start(g.children[tag])
+	}
+	g.mu.Unlock()
+
+	<-ctx.Done()
+
+	// no more starting
+	g.mu.Lock()
+	g.ctx = nil
+	g.mu.Unlock()
+
+	g.wg.Wait()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, c := range g.children {
+		c.stop() // already exited, just reset
+	}
+	g.closeOutputs()
+	return nil
+}
+
+func (g *Group) closeOutputs() {
+	for _, c := range g.children {
+		_ = c.out.Close()
+		c.out = nil
+	}
+}
+
+// Start guarding the process. No-op if already started, or removed from the group.
+// Must be called with g.mu held and g.ctx not nil.
+func (g *Group) start(c *child) {
+	if g.children[c.Tag] != c {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cancel != nil {
+		return
+	}
+
+	run := startChild
+	if c.Mode == ModeCron {
+		run = runCron
+	}
+
+	ctx, cancel := context.WithCancel(g.ctx)
+	done := make(chan struct{})
+	gd := guard.New(guard.Conf{
+		Tag: c.Tag,
+		Fn: func(ctx context.Context) error {
+			if !g.waitDeps(ctx, c) {
+				return nil
+			}
+
+			err := run(ctx, c)
+			// A oneshot process satisfies its dependents once it succeeds.
+			if c.Mode == ModeOneshot && err == nil && ctx.Err() == nil {
+				c.setHealthy(true)
+			}
+			return err
+		},
+		Bf: c.Bf,
+		// A oneshot process is done once it succeeds.
+		AlsoRetryOnSuccess: c.Mode != ModeOneshot,
+	})
+
+	c.guard, c.cancel, c.done = gd, cancel, done
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer close(done)
+
+		gd.Run(ctx)
+
+		// The guard may exit on its own, e.g. a oneshot process succeeds. Allow it to be started again.
+		c.mu.Lock()
+		if c.done == done {
+			c.cancel = nil
+		}
+		c.mu.Unlock()
+		cancel()
+	}()
+}
+
+// Stop guarding the process, and wait until it exits. No-op if already stopped.
+func (c *child) stop() {
+	c.mu.Lock()
+	cancel, done := c.cancel, c.done
+	c.cancel = nil
+	c.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+// Wait until all dependencies of the process are healthy. Return false if ctx.Done channel is closed.
+func (g *Group) waitDeps(ctx context.Context, c *child) bool {
+	logged := false
+
+	for {
+		g.healthMu.Lock()
+		ch := g.healthCh
+		g.healthMu.Unlock()
+
+		var pending []string
+		g.mu.Lock()
+		for _, tag := range c.DependsOn {
+			dep, ok := g.children[tag]
+			if !ok || !dep.isHealthy() {
+				pending = append(pending, tag)
+			}
+		}
+		g.mu.Unlock()
+
+		if len(pending) < 1 {
+			return true
+		}
+
+		if !logged {
+			g.lg.Info("%v waiting for dependencies %v", c.Tag, pending)
+			logged = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ch:
+		}
+	}
+}
+
+func (g *Group) notifyHealth() {
+	g.healthMu.Lock()
+	defer g.healthMu.Unlock()
+
+	close(g.healthCh)
+	g.healthCh = make(chan struct{})
+}
+
+func (g *Group) get(tag string) (*child, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx == nil {
+		return nil, ErrNotRunning
+	}
+
+	c, ok := g.children[tag]
+	if !ok {
+		return nil, ErrNoSuchProc
+	}
+
+	return c, nil
+}
+
+// Start the process of the tag. No-op if already started.
+func (g *Group) Start(tag string) error {
+	c, err := g.get(tag)
+	if err != nil {
+		return err
+	}
+
+	c.ctlMu.Lock()
+	defer c.ctlMu.Unlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx == nil {
+		return ErrNotRunning
+	}
+
+	g.start(c)
+	return nil
+}
+
+// Stop the process of the tag, and wait until it exits. No-op if already stopped.
+// The process will not be restarted until Start or Restart is called.
+func (g *Group) Stop(tag string) error {
+	c, err := g.get(tag)
+	if err != nil {
+		return err
+	}
+
+	c.ctlMu.Lock()
+	defer c.ctlMu.Unlock()
+
+	c.stop()
+	return nil
+}
+
+// Stop the process of the tag, and start it again.
+func (g *Group) Restart(tag string) error {
+	c, err := g.get(tag)
+	if err != nil {
+		return err
+	}
+
+	c.ctlMu.Lock()
+	defer c.ctlMu.Unlock()
+
+	c.stop()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.ctx == nil {
+		return ErrNotRunning
+	}
+
+	g.start(c)
+	return nil
+}
+
+// Return statuses of all processes, in order of procs.
+func (g *Group) Status() []ProcStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	l := make([]ProcStatus, 0, len(g.tags))
+	for _, tag := range g.tags {
+		l = append(l, g.children[tag].status())
+	}
+
+	return l
+}
+
+func (c *child) status() ProcStatus {
+	c.mu.Lock()
+	gd, healthy := c.guard, c.healthy
+	c.mu.Unlock()
+
+	st := ProcStatus{
+		Status:  guard.Status{Tag: c.Tag},
+		Pid:     int(atomic.LoadInt64(&c.pid)),
+		Healthy: healthy,
+	}
+	if gd != nil {
+		st.Status = gd.Status()
+	}
+
+	return st
+}
+
+// Return the last n lines of stdout/stderr of the process of the tag.
+func (g *Group) Tail(tag string, n int) ([]string, error) {
+	c, err := g.get(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c.out == nil {
+		return nil, nil
+	}
+
+	return c.out.tail.last(n), nil
+}
+
+// Replace the processes of the group with procs. Tags of procs must be unique.
+// Processes with new tags are started, processes whose tags are absent in procs are stopped,
+// processes whose definitions changed are restarted, and the rest are left untouched.
+// If the group is not running, only the definitions are replaced.
+func (g *Group) Reconcile(procs ...Proc) error {
+	err := validateProcs(procs)
+	if err != nil {
+		return err
+	}
+
+	g.reconcileMu.Lock()
+	defer g.reconcileMu.Unlock()
+
+	var started, stopped, restarted []string
+	var olds []*child
+	var news []*child
+	tags := make([]string, 0, len(procs))
+	inProcs := make(map[string]struct{}, len(procs))
+
+	g.mu.Lock()
+	for _, proc := range procs {
+		tags = append(tags, proc.Tag)
+		inProcs[proc.Tag] = struct{}{}
+
+		c, ok := g.children[proc.Tag]
+		if ok && reflect.DeepEqual(c.Proc, proc) {
+			continue
+		}
+
+		if ok {
+			olds = append(olds, c)
+			restarted = append(restarted, proc.Tag)
+		} else {
+			started = append(started, proc.Tag)
+		}
+
+		nc := &child{Proc: proc, g: g}
+		news = append(news, nc)
+		g.children[proc.Tag] = nc
+	}
+
+	for _, tag := range g.tags {
+		if _, ok := inProcs[tag]; !ok {
+			olds = append(olds, g.children[tag])
+			stopped = append(stopped, tag)
+			delete(g.children, tag)
+		}
+	}
+	g.tags = tags
+	g.mu.Unlock()
+
+	// Replaced children can no longer be started, since they are not in the group.
+	for _, c := range olds {
+		c.ctlMu.Lock()
+		c.stop()
+		c.ctlMu.Unlock()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, c := range olds {
+		_ = c.out.Close()
+		c.out = nil
+	}
+
+	if len(started)+len(stopped)+len(restarted) > 0 {
+		g.lg.Info("reconciling. start: %v, stop: %v, restart: %v", started, stopped, restarted)
+	}
+
+	if g.ctx == nil {
+		return nil
+	}
+
+	// Open outputs of as many procs as possible, and return the first error.
+	var firstErr error
+	for _, c := range news {
+		out, err := openOutput(c.Proc)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error opening output of proc %v: %w", c.Tag, err)
+			}
+			continue
+		}
+		c.out = out
+
+		g.start(c)
+	}
+
+	return firstErr
+}
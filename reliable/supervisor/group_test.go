@@ -0,0 +1,178 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/guard"
+)
+
+func TestGroup(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	g, err := NewGroup(
+		Proc{Tag: "a", Path: "/bin/sh", Args: []string{"-c", "echo a1; echo a2; sleep 10"}},
+		Proc{Tag: "b", Path: "/bin/sh", Args: []string{"-c", "sleep 10"}},
+	)
+	as.Nil(err)
+
+	as.ErrorIs(g.Start("a"), ErrNotRunning)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	running := func(tag string) func() bool {
+		return func() bool {
+			for _, st := range g.Status() {
+				if st.Tag == tag {
+					return st.State == guard.StateRunning && st.Pid > 0
+				}
+			}
+			return false
+		}
+	}
+	as.Eventually(running("a"), time.Second, time.Millisecond*10)
+	as.Eventually(running("b"), time.Second, time.Millisecond*10)
+
+	as.Eventually(func() bool {
+		lines, err := g.Tail("a", 1)
+		return err == nil && len(lines) == 1 && lines[0] == "a2"
+	}, time.Second, time.Millisecond*10)
+
+	lines, err := g.Tail("a", 10)
+	as.Nil(err)
+	as.Equal([]string{"a1", "a2"}, lines)
+
+	as.Nil(g.Stop("a"))
+	st := g.Status()[0]
+	as.Equal(guard.StateStopped, st.State)
+	as.Equal(0, st.Pid)
+
+	as.Nil(g.Start("a"))
+	as.Eventually(running("a"), time.Second, time.Millisecond*10)
+
+	pid := g.Status()[1].Pid
+	as.Nil(g.Restart("b"))
+	as.Eventually(running("b"), time.Second, time.Millisecond*10)
+	as.NotEqual(pid, g.Status()[1].Pid)
+
+	as.ErrorIs(g.Stop("c"), ErrNoSuchProc)
+	_, err = g.Tail("c", 1)
+	as.ErrorIs(err, ErrNoSuchProc)
+
+	cancel()
+	as.Nil(<-done)
+	for _, st := range g.Status() {
+		as.Equal(guard.StateStopped, st.State)
+	}
+}
+
+func TestGroupDuplicateTag(t *testing.T) {
+	_, err := NewGroup(
+		Proc{Tag: "a", Path: "/bin/sh"},
+		Proc{Tag: "a", Path: "/bin/sh"},
+	)
+	require.Error(t, err)
+}
+
+func TestValidateAll(t *testing.T) {
+	as := require.New(t)
+
+	errs := ValidateAll(
+		Proc{Tag: "a", Path: "/bin/sh", DependsOn: []string{"x"}},
+		Proc{Tag: "a", Path: ""},
+		Proc{Tag: "b", Path: "/bin/sh", DependsOn: []string{"c"}},
+		Proc{Tag: "c", Path: "/bin/sh", DependsOn: []string{"b"}},
+	)
+
+	var msgs []string
+	var idxs []int
+	for _, err := range errs {
+		var pe *ProcError
+		as.ErrorAs(err, &pe)
+		msgs = append(msgs, pe.Error())
+		idxs = append(idxs, pe.Index)
+	}
+	as.Equal([]string{
+		"proc a depends on unknown proc x",
+		"empty command",
+		"duplicate tag a",
+		"dependency cycle involving proc b",
+	}, msgs)
+	as.Equal([]int{0, 1, 1, 2}, idxs)
+
+	// the first error
+	as.EqualError(Validate(Proc{Tag: "a", Path: "/bin/sh", DependsOn: []string{"x"}}, Proc{Tag: "a", Path: ""}),
+		"proc a depends on unknown proc x")
+
+	as.Equal([]error{errNoProc}, ValidateAll())
+	as.Empty(ValidateAll(Proc{Tag: "a", Path: "/bin/sh"}))
+}
+
+func TestReconcile(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	sleep := func(tag, arg string) Proc {
+		return Proc{Tag: tag, Path: "/bin/sh", Args: []string{"-c", "sleep " + arg}}
+	}
+
+	g, err := NewGroup(sleep("a", "10"), sleep("b", "10"), sleep("c", "10"))
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	pids := func() map[string]int {
+		m := make(map[string]int)
+		for _, st := range g.Status() {
+			if st.State == guard.StateRunning && st.Pid > 0 {
+				m[st.Tag] = st.Pid
+			}
+		}
+		return m
+	}
+	as.Eventually(func() bool { return len(pids()) == 3 }, time.Second, time.Millisecond*10)
+	before := pids()
+
+	// a untouched, b changed, c removed, d added
+	as.Nil(g.Reconcile(sleep("a", "10"), sleep("b", "20"), sleep("d", "10")))
+	as.Eventually(func() bool { return len(pids()) == 3 }, time.Second, time.Millisecond*10)
+	after := pids()
+
+	as.Equal(before["a"], after["a"])
+	as.NotEqual(before["b"], after["b"])
+	as.NotContains(after, "c")
+	as.Contains(after, "d")
+
+	var tags []string
+	for _, st := range g.Status() {
+		tags = append(tags, st.Tag)
+	}
+	as.Equal([]string{"a", "b", "d"}, tags)
+
+	as.ErrorIs(g.Start("c"), ErrNoSuchProc)
+	as.ErrorIs(g.Reconcile(), errNoProc)
+
+	cancel()
+	as.Nil(<-done)
+}
@@ -0,0 +1,223 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// Health check of a process. At most one of TCP, HTTP and Exec may be set.
+// If none is set, the process is deemed healthy once started.
+type Health struct {
+	// Address to connect, e.g. 127.0.0.1:8080. Healthy if connected.
+	TCP string
+	// URL to GET, e.g. http://127.0.0.1:8080/healthz. Healthy if the status code is 2xx or 3xx.
+	HTTP string
+	// Command and args to run. Healthy if the command exits with 0.
+	Exec []string
+	// Interval between probes. Default to 10s.
+	Interval time.Duration
+	// Timeout of a probe. Default to 3s.
+	Timeout time.Duration
+	// Failures in StartPeriod after the process starts are not counted. Default to 0.
+	StartPeriod time.Duration
+	// The process is deemed unhealthy after Threshold consecutive failures. Default to 3.
+	Threshold int
+	// If true, restart the process once it's deemed unhealthy.
+	Restart bool
+}
+
+const (
+	defHealthInterval  = time.Second * 10
+	defHealthTimeout   = time.Second * 3
+	defHealthThreshold = 3
+)
+
+var errUnhealthy = errors.New("unhealthy")
+
+func (h Health) enabled() bool {
+	return h.TCP != "" || h.HTTP != "" || len(h.Exec) > 0
+}
+
+func (h Health) validate() error {
+	n := 0
+	if h.TCP != "" {
+		n++
+		_, _, err := net.SplitHostPort(h.TCP)
+		if err != nil {
+			return fmt.Errorf("invalid tcp health check: %w", err)
+		}
+	}
+
+	if h.HTTP != "" {
+		n++
+		u, err := url.Parse(h.HTTP)
+		if err != nil {
+			return fmt.Errorf("invalid http health check: %w", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid http health check: unsupported scheme %q", u.Scheme)
+		}
+	}
+
+	if len(h.Exec) > 0 {
+		n++
+		if len(h.Exec[0]) < 1 {
+			return errors.New("invalid exec health check: empty command")
+		}
+	}
+
+	if n > 1 {
+		return errors.New("at most one of tcp, http and exec health checks may be set")
+	}
+
+	return nil
+}
+
+// Probe once. Return nil if healthy.
+func (h Health) probe(ctx context.Context) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defHealthTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch {
+	case h.TCP != "":
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", h.TCP)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+
+	case h.HTTP != "":
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.HTTP, nil)
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("status code %v", resp.StatusCode)
+		}
+		return nil
+
+	default:
+		return exec.CommandContext(ctx, h.Exec[0], h.Exec[1:]...).Run()
+	}
+}
+
+// Probe the health of the started process periodically until ctx.Done channel is closed.
+// If the process is deemed unhealthy and Health.Restart is true, close the unhealthy channel and return.
+func (c *child) checkHealth(ctx context.Context, unhealthy chan<- struct{}) {
+	// A oneshot process is deemed healthy only once it exits successfully. See Group.
+	if c.Mode == ModeOneshot {
+		return
+	}
+
+	h := c.Health
+	if !h.enabled() {
+		c.setHealthy(true)
+		return
+	}
+
+	lg := log.WithTag(c.Tag)
+
+	interval := h.Interval
+	if interval <= 0 {
+		interval = defHealthInterval
+	}
+
+	threshold := h.Threshold
+	if threshold <= 0 {
+		threshold = defHealthThreshold
+	}
+
+	start := time.Now()
+	fails := 0
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := h.probe(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		timer.Reset(interval)
+
+		if err == nil {
+			fails = 0
+			c.setHealthy(true)
+			continue
+		}
+
+		if time.Since(start) < h.StartPeriod {
+			continue
+		}
+
+		fails++
+		lg.Debug("health check failed (%v/%v): %v", fails, threshold, err)
+		if fails < threshold {
+			continue
+		}
+
+		if fails == threshold {
+			lg.Warn("unhealthy: %v", err)
+		}
+		c.setHealthy(false)
+
+		if h.Restart {
+			close(unhealthy)
+			return
+		}
+	}
+}
+
+func (c *child) isHealthy() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.healthy
+}
+
+func (c *child) setHealthy(healthy bool) {
+	c.mu.Lock()
+	changed := c.healthy != healthy
+	c.healthy = healthy
+	c.mu.Unlock()
+
+	if changed && c.g != nil {
+		c.g.notifyHealth()
+	}
+}
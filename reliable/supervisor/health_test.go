@@ -0,0 +1,150 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/backoff"
+)
+
+func TestProbe(t *testing.T) {
+	as := require.New(t)
+	ctx := context.Background()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	as.Nil(err)
+	addr := ln.Addr().String()
+	as.Nil(Health{TCP: addr}.probe(ctx))
+	ln.Close()
+	as.Error(Health{TCP: addr}.probe(ctx))
+
+	code := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+	}))
+	defer srv.Close()
+	as.Nil(Health{HTTP: srv.URL}.probe(ctx))
+	code = http.StatusServiceUnavailable
+	as.Error(Health{HTTP: srv.URL}.probe(ctx))
+
+	as.Nil(Health{Exec: []string{"/bin/sh", "-c", "exit 0"}}.probe(ctx))
+	as.Error(Health{Exec: []string{"/bin/sh", "-c", "exit 1"}}.probe(ctx))
+	as.Error(Health{Exec: []string{"/bin/sh", "-c", "sleep 1"}, Timeout: time.Millisecond * 10}.probe(ctx))
+}
+
+func TestHealthRestart(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	g, err := NewGroup(Proc{
+		Tag:  "a",
+		Path: "/bin/sh",
+		Args: []string{"-c", "sleep 10"},
+		Bf:   backoff.Conf{Min: time.Millisecond, Max: time.Millisecond, Unit: time.Millisecond},
+		Health: Health{
+			Exec:      []string{"/bin/sh", "-c", "exit 1"},
+			Interval:  time.Millisecond * 10,
+			Threshold: 2,
+			Restart:   true,
+		},
+	})
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	as.Eventually(func() bool {
+		st := g.Status()[0]
+		return st.Restarts >= 2 && st.LastErr == errUnhealthy
+	}, time.Second*2, time.Millisecond*10)
+
+	cancel()
+	as.Nil(<-done)
+}
+
+func TestDependsOn(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ready := filepath.Join(t.TempDir(), "ready")
+
+	g, err := NewGroup(
+		Proc{
+			Tag:       "app",
+			Path:      "/bin/sh",
+			Args:      []string{"-c", "sleep 10"},
+			DependsOn: []string{"db"},
+		},
+		Proc{
+			Tag:  "db",
+			Path: "/bin/sh",
+			Args: []string{"-c", "sleep 10"},
+			Health: Health{
+				Exec:     []string{"/bin/sh", "-c", "test -f " + ready},
+				Interval: time.Millisecond * 10,
+			},
+		},
+	)
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	as.Eventually(func() bool {
+		return g.Status()[1].Pid > 0
+	}, time.Second, time.Millisecond*10)
+
+	time.Sleep(time.Millisecond * 100)
+	st := g.Status()
+	as.False(st[1].Healthy)
+	as.Equal(0, st[0].Pid)
+
+	as.Nil(os.WriteFile(ready, nil, 0600))
+
+	as.Eventually(func() bool {
+		st := g.Status()
+		return st[1].Healthy && st[0].Pid > 0 && st[0].Healthy
+	}, time.Second, time.Millisecond*10)
+
+	cancel()
+	as.Nil(<-done)
+}
+
+func TestDependsOnInvalid(t *testing.T) {
+	as := require.New(t)
+
+	_, err := NewGroup(Proc{Tag: "a", Path: "/bin/sh", DependsOn: []string{"b"}})
+	as.ErrorContains(err, "unknown proc")
+
+	_, err = NewGroup(
+		Proc{Tag: "a", Path: "/bin/sh", DependsOn: []string{"b"}},
+		Proc{Tag: "b", Path: "/bin/sh", DependsOn: []string{"a"}},
+	)
+	as.ErrorContains(err, "cycle")
+
+	_, err = NewGroup(Proc{Tag: "a", Path: "/bin/sh", Health: Health{TCP: ":1", HTTP: "http://x"}})
+	as.ErrorContains(err, "at most one")
+}
@@ -0,0 +1,126 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+)
+
+// Run mode of a process
+type RunMode byte
+
+const (
+	// Long-running. Restarted whenever it exits.
+	ModeDaemon RunMode = iota
+	// Run once. Restarted only if it fails.
+	ModeOneshot
+	// Run periodically according to Proc.Schedule. Never restarted between scheduled runs.
+	ModeCron
+)
+
+func (m RunMode) String() string {
+	switch m {
+	case ModeDaemon:
+		return "daemon"
+	case ModeOneshot:
+		return "oneshot"
+	case ModeCron:
+		return "cron"
+	default:
+		return "unknown"
+	}
+}
+
+// What to do if a scheduled run is due while the previous run is still active
+type Overlap byte
+
+const (
+	// Skip the due run.
+	OverlapSkip Overlap = iota
+	// Run right after the previous run exits. At most one run is queued.
+	OverlapQueue
+)
+
+// Run the process according to its schedule until ctx.Done channel is closed.
+// The active run, if any, is stopped before returning.
+func runCron(ctx context.Context, c *child) error {
+	sched, err := parseSchedule(c.Schedule)
+	if err != nil {
+		return err
+	}
+
+	lg := log.WithTag(c.Tag)
+
+	var running chan struct{} // closed once the active run exits
+	queued := false
+
+	start := func() {
+		done := make(chan struct{})
+		running = done
+
+		go func() {
+			defer close(done)
+
+			err := startChild(ctx, c)
+			if err != nil && ctx.Err() == nil {
+				lg.Warn("scheduled run failed: %v", err)
+			}
+		}()
+	}
+
+	for {
+		next := sched.next(time.Now())
+		if next.IsZero() {
+			lg.Warn("no next run of schedule %q", c.Schedule)
+			next = time.Now().AddDate(1, 0, 0)
+		}
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			if running != nil {
+				<-running
+			}
+			return nil
+
+		case <-running:
+			timer.Stop()
+			running = nil
+			if queued {
+				queued = false
+				start()
+			}
+			continue
+
+		case <-timer.C:
+		}
+
+		if running == nil {
+			start()
+			continue
+		}
+
+		if c.Overlap == OverlapQueue {
+			if queued {
+				lg.Warn("previous run still active and another run already queued, skip the run due at %v", next)
+			} else {
+				lg.Info("previous run still active, queue the run due at %v", next)
+				queued = true
+			}
+			continue
+		}
+
+		lg.Warn("previous run still active, skip the run due at %v", next)
+	}
+}
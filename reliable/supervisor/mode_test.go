@@ -0,0 +1,143 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/backoff"
+	"github.com/burningxflame/gx/reliable/guard"
+)
+
+func TestOneshot(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	counter := t.TempDir() + "/n"
+	bf := backoff.Conf{Min: time.Millisecond, Max: time.Millisecond, Unit: time.Millisecond}
+
+	g, err := NewGroup(
+		// succeeds at once
+		Proc{Tag: "ok", Path: "/bin/sh", Args: []string{"-c", "exit 0"}, Mode: ModeOneshot, Bf: bf},
+		// fails twice, then succeeds
+		Proc{
+			Tag:  "retry",
+			Path: "/bin/sh",
+			Args: []string{"-c", "echo x >> " + counter + "; test $(wc -l < " + counter + ") -ge 3"},
+			Mode: ModeOneshot,
+			Bf:   bf,
+		},
+	)
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	as.Eventually(func() bool {
+		for _, st := range g.Status() {
+			if st.State != guard.StateStopped || st.LastStart.IsZero() {
+				return false
+			}
+		}
+		return true
+	}, time.Second*2, time.Millisecond*10)
+
+	st := g.Status()
+	as.Equal(0, st[0].Restarts)
+	as.Nil(st[0].LastErr)
+	as.Equal(2, st[1].Restarts)
+	as.Nil(st[1].LastErr)
+
+	// run again on demand
+	last := st[0].LastStart
+	as.Nil(g.Start("ok"))
+	as.Eventually(func() bool {
+		st := g.Status()[0]
+		return st.State == guard.StateStopped && st.LastStart.After(last)
+	}, time.Second, time.Millisecond*10)
+
+	cancel()
+	as.Nil(<-done)
+}
+
+// Dependents of a oneshot process start only after it succeeds, and may restart afterwards.
+func TestDependsOnOneshot(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	dir := t.TempDir()
+	marker, out := dir+"/marker", dir+"/out"
+
+	g, err := NewGroup(
+		Proc{
+			Tag:  "migrate",
+			Path: "/bin/sh",
+			Args: []string{"-c", "sleep 0.2; touch " + marker},
+			Mode: ModeOneshot,
+		},
+		Proc{
+			Tag:       "app",
+			Path:      "/bin/sh",
+			Args:      []string{"-c", "if test -f " + marker + "; then echo ok >> " + out + "; else echo early >> " + out + "; fi; sleep 10"},
+			DependsOn: []string{"migrate"},
+		},
+	)
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	appRunning := func() bool {
+		st := g.Status()[1]
+		return st.State == guard.StateRunning && st.Pid > 0
+	}
+	as.Eventually(appRunning, time.Second*2, time.Millisecond*10)
+	as.Eventually(func() bool {
+		content, _ := os.ReadFile(out)
+		return string(content) == "ok\n"
+	}, time.Second, time.Millisecond*10)
+
+	st := g.Status()[0]
+	as.Equal(guard.StateStopped, st.State)
+	as.True(st.Healthy)
+
+	// restart of the dependent does not wait forever
+	pid := g.Status()[1].Pid
+	as.Nil(g.Restart("app"))
+	as.Eventually(func() bool {
+		return appRunning() && g.Status()[1].Pid != pid
+	}, time.Second, time.Millisecond*10)
+
+	cancel()
+	as.Nil(<-done)
+}
+
+func TestValidateMode(t *testing.T) {
+	as := require.New(t)
+
+	as.Nil(Proc{Path: "/bin/sh", Mode: ModeCron, Schedule: "@daily"}.Validate())
+	// leap day
+	as.Nil(Proc{Path: "/bin/sh", Mode: ModeCron, Schedule: "0 0 29 2 *"}.Validate())
+	as.Error(Proc{Path: "/bin/sh", Mode: ModeCron, Schedule: "0 0 30 2 *"}.Validate())
+	as.Error(Proc{Path: "/bin/sh", Mode: ModeCron}.Validate())
+	as.Error(Proc{Path: "/bin/sh", Schedule: "@daily"}.Validate())
+	as.Error(Proc{Path: "/bin/sh", Mode: 9}.Validate())
+}
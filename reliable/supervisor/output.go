@@ -0,0 +1,307 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/burningxflame/gx/ds/ringbuf"
+	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/log/rotate"
+)
+
+// Where stdout/stderr of a process go
+type Output struct {
+	// OutputNone, OutputLog or OutputFile. Default to OutputNone.
+	Mode OutputMode
+	// Log-rotating config. Only for OutputFile.
+	Rc rotate.Conf
+}
+
+type OutputMode byte
+
+const (
+	// Discard
+	OutputNone OutputMode = iota
+	// Log line by line with the global logger, tagged with the proc tag. Stdout in level Info, stderr in level Warn.
+	OutputLog
+	// Write into a rotated file
+	OutputFile
+)
+
+func (o Output) validate() error {
+	switch o.Mode {
+	case OutputNone, OutputLog:
+		return nil
+	case OutputFile:
+		if len(o.Rc.FilePath) == 0 {
+			return errEmptyOutputPath
+		}
+		return nil
+	default:
+		return errInvalidOutputMode
+	}
+}
+
+var (
+	errInvalidOutputMode = errors.New("invalid output mode")
+	errEmptyOutputPath   = errors.New("empty output file path")
+)
+
+// Output of a process, shared by all runs of the process.
+type output struct {
+	mode OutputMode
+	lg   log.TagLogger
+	file io.WriteCloser
+	tail *tail
+}
+
+// Open the output of the process.
+func openOutput(proc Proc) (*output, error) {
+	o := &output{
+		mode: proc.Output.Mode,
+		tail: newTail(tailLines),
+	}
+
+	switch proc.Output.Mode {
+	case OutputLog:
+		o.lg = log.WithTag(proc.Tag)
+
+	case OutputFile:
+		f, err := rotate.New(proc.Output.Rc)
+		if err != nil {
+			return nil, err
+		}
+		o.file = f
+	}
+
+	return o, nil
+}
+
+// Number of the last output lines kept in memory for each process
+const tailLines = 100
+
+// Return writers of stdout and stderr for a run of the process, and a func to flush them after the process exits.
+// The last lines of output are always kept in memory, whatever the mode is.
+func (o *output) writers() (stdout, stderr io.Writer, flush func()) {
+	if o == nil {
+		return nil, nil, func() {}
+	}
+
+	fnOut, fnErr := o.tail.add, o.tail.add
+	if o.mode == OutputLog {
+		fnOut = func(line []byte) {
+			o.tail.add(line)
+			o.lg.Info("%s", line)
+		}
+		fnErr = func(line []byte) {
+			o.tail.add(line)
+			o.lg.Warn("%s", line)
+		}
+	}
+
+	wo := &lineWriter{fn: fnOut}
+	we := &lineWriter{fn: fnErr}
+	flush = func() {
+		wo.flush()
+		we.flush()
+	}
+
+	if o.mode == OutputFile {
+		return io.MultiWriter(o.file, wo), io.MultiWriter(o.file, we), flush
+	}
+
+	return wo, we, flush
+}
+
+// Pipes of stdout and stderr of a run of the process.
+// Created here rather than by exec, so that cmd.Wait returns once the process exits,
+// instead of waiting for grandchildren which inherit the pipes and keep them open.
+type pipes struct {
+	ws, rs []*os.File
+	wg     sync.WaitGroup
+	flush  func()
+}
+
+// Attach stdout and stderr of cmd to the output via pipes. Must be called before cmd.Start.
+// Call started after cmd.Start, and close after the process group is killed.
+func (o *output) attach(cmd *exec.Cmd) (*pipes, error) {
+	stdout, stderr, flush := o.writers()
+	if stdout == nil {
+		return nil, nil
+	}
+
+	p := &pipes{flush: flush}
+	for _, w := range []io.Writer{stdout, stderr} {
+		r, pw, err := os.Pipe()
+		if err != nil {
+			p.started()
+			p.close()
+			return nil, err
+		}
+		p.rs = append(p.rs, r)
+		p.ws = append(p.ws, pw)
+
+		w := w
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			_, _ = io.Copy(w, r)
+		}()
+	}
+
+	cmd.Stdout, cmd.Stderr = p.ws[0], p.ws[1]
+	return p, nil
+}
+
+// Close the write ends held by the supervisor, so that the pipes reach EOF once the process group exits.
+func (p *pipes) started() {
+	if p == nil {
+		return
+	}
+
+	for _, w := range p.ws {
+		_ = w.Close()
+	}
+}
+
+// Max time to drain the pipes after the process group is killed.
+// Output of processes escaping the group, e.g. by setsid, is cut off after it.
+const drainTimeout = time.Second
+
+// Drain and close the pipes, and flush the writers.
+func (p *pipes) close() {
+	if p == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+	}
+
+	for _, r := range p.rs {
+		_ = r.Close()
+	}
+	<-done
+	p.flush()
+}
+
+func (o *output) Close() error {
+	if o == nil || o.file == nil {
+		return nil
+	}
+
+	return o.file.Close()
+}
+
+// The last lines of output
+type tail struct {
+	mu    sync.Mutex
+	max   int
+	lines *ringbuf.RingBuf[string]
+}
+
+func newTail(max int) *tail {
+	return &tail{
+		max:   max,
+		lines: ringbuf.New[string](max),
+	}
+}
+
+func (t *tail) add(line []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.lines.Len() >= t.max {
+		t.lines.PopFront()
+	}
+	t.lines.PushBack(string(line))
+}
+
+// Return the last n lines.
+func (t *tail) last(n int) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	skip := t.lines.Len() - n
+	l := make([]string, 0, t.lines.Len())
+
+	i := 0
+	t.lines.ForEach(func(line string) {
+		if i >= skip {
+			l = append(l, line)
+		}
+		i++
+	})
+
+	return l
+}
+
+// Split written data into lines, and call fn for every line, without the trailing newline.
+// Lines longer than maxLineLen are split.
+type lineWriter struct {
+	fn  func(line []byte)
+	buf []byte
+}
+
+const maxLineLen = 64 << 10
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.buf = append(w.buf, p...)
+			for len(w.buf) >= maxLineLen {
+				w.fn(w.buf[:maxLineLen])
+				w.buf = append(w.buf[:0], w.buf[maxLineLen:]...)
+			}
+			break
+		}
+
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, p[:i]...)
+			w.fn(bytes.TrimSuffix(w.buf, cr))
+			w.buf = w.buf[:0]
+		} else {
+			w.fn(bytes.TrimSuffix(p[:i], cr))
+		}
+
+		p = p[i+1:]
+	}
+
+	return n, nil
+}
+
+var cr = []byte{'\r'}
+
+// Call fn for the remaining incomplete line, if any.
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.fn(w.buf)
+		w.buf = w.buf[:0]
+	}
+}
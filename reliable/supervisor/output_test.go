@@ -0,0 +1,120 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/log/rotate"
+)
+
+func TestLineWriter(t *testing.T) {
+	as := require.New(t)
+
+	var lines []string
+	w := &lineWriter{fn: func(line []byte) {
+		lines = append(lines, string(line))
+	}}
+
+	for _, s := range []string{"a", "b\nc\r\n", "\n", "d\ne", "f"} {
+		n, err := w.Write([]byte(s))
+		as.Nil(err)
+		as.Equal(len(s), n)
+	}
+	as.Equal([]string{"ab", "c", "", "d"}, lines)
+
+	w.flush()
+	as.Equal([]string{"ab", "c", "", "d", "ef"}, lines)
+
+	lines = nil
+	w.Write([]byte(strings.Repeat("x", maxLineLen+1)))
+	w.flush()
+	as.Len(lines, 2)
+	as.Len(lines[0], maxLineLen)
+	as.Len(lines[1], 1)
+}
+
+func TestOutputFile(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "out.log")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+	defer cancel()
+
+	err := Supervisor(ctx, Proc{
+		Tag:  "a",
+		Path: "/bin/sh",
+		Args: []string{"-c", "echo out; echo err >&2; sleep 1"},
+		Output: Output{
+			Mode: OutputFile,
+			Rc:   rotate.Conf{FilePath: pa},
+		},
+	})
+	as.Nil(err)
+
+	content, err := os.ReadFile(pa)
+	as.Nil(err)
+	as.ElementsMatch([]string{"out", "err"}, strings.Fields(string(content)))
+}
+
+func TestOutputLog(t *testing.T) {
+	as := require.New(t)
+
+	lg := &captureLogger{}
+	as.Nil(log.Set(lg, log.LevelInfo))
+	defer log.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+	defer cancel()
+
+	err := Supervisor(ctx, Proc{
+		Tag:    "a",
+		Path:   "/bin/sh",
+		Args:   []string{"-c", "echo out; printf err >&2; sleep 1"},
+		Output: Output{Mode: OutputLog},
+	})
+	as.Nil(err)
+
+	as.Contains(lg.lines(), "INFO  [a] out")
+	as.Contains(lg.lines(), "WARN  [a] err")
+}
+
+type captureLogger struct {
+	mu sync.Mutex
+	l  []string
+}
+
+func (c *captureLogger) Printf(format string, v ...any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.l = append(c.l, fmt.Sprintf(format, v...))
+}
+
+func (c *captureLogger) Close() error {
+	return nil
+}
+
+func (c *captureLogger) lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string{}, c.l...)
+}
@@ -0,0 +1,307 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/backoff"
+)
+
+type Proc struct {
+	Tag  string       // Used to tag log messages
+	Path string       // Path of the command to run
+	Args []string     // Args of the command
+	Bf   backoff.Conf // Backoff strategy determines how long to wait between retries
+	// Signal sent to the process group to stop the process. Default to SIGTERM.
+	StopSignal syscall.Signal
+	// If the process does not exit in StopTimeout after StopSignal is sent, kill the process group with SIGKILL. Default to 10s.
+	StopTimeout time.Duration
+	// Env vars of the process, in the form "key=value". Override the inherited ones.
+	Env []string
+	// If true, do not inherit env vars of the supervisor, i.e. the process has only env vars in Env.
+	ClearEnv bool
+	// Working directory of the process. Default to the working directory of the supervisor.
+	Dir string
+	// User to run the process as. Name or uid. Default to the user of the supervisor.
+	User string
+	// Group to run the process as. Name or gid. Default to the primary group of User.
+	Group string
+	// File mode creation mask of the process. Default to the umask of the supervisor.
+	Umask *fs.FileMode
+	// Resource limits of the process. Linux only.
+	// Applied before the process runs its first instruction, i.e. the process is started under ptrace, stopped right after exec,
+	// and detached once the limits are set. So starting fails if ptrace is not permitted, e.g. by seccomp or Yama.
+	Rlimits []Rlimit
+	// Where stdout/stderr of the process go. Default to discarded.
+	Output Output
+	// Health check of the process. Default to none, i.e. healthy once started.
+	// Ignored by ModeOneshot, in which case the process is deemed healthy once it exits successfully, and stays healthy afterwards.
+	Health Health
+	// Tags of procs which must be healthy before the process starts, e.g. a oneshot migration which must succeed first.
+	// Only checked before starting, i.e. the process is not stopped if a dependency becomes unhealthy later.
+	DependsOn []string
+	// Run mode of the process. Default to ModeDaemon.
+	Mode RunMode
+	// Cron expression, e.g. "*/5 * * * *" or "@daily". Required by and only applies to ModeCron.
+	Schedule string
+	// What to do if a scheduled run is due while the previous run is still active. Only applies to ModeCron.
+	// Default to OverlapSkip.
+	Overlap Overlap
+}
+
+// Resource limit
+type Rlimit struct {
+	// Name of the resource, i.e. as, core, cpu, data, fsize, nofile or stack.
+	Resource string
+	// Soft limit
+	Soft uint64
+	// Hard limit
+	Hard uint64
+}
+
+// Validate the Proc. Return the first error found.
+func (p Proc) Validate() error {
+	if len(p.Path) < 1 {
+		return errEmptyCmd
+	}
+
+	for _, kv := range p.Env {
+		if !strings.Contains(kv, "=") {
+			return fmt.Errorf("invalid env var %q, should be in the form key=value", kv)
+		}
+	}
+
+	if len(p.Dir) > 0 {
+		info, err := os.Stat(p.Dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%v is not a directory", p.Dir)
+		}
+	}
+
+	_, err := credential(p.User, p.Group)
+	if err != nil {
+		return err
+	}
+
+	if p.Umask != nil && !umaskSupported {
+		return errUmaskUnsupported
+	}
+	if p.Umask != nil && *p.Umask > fs.ModePerm {
+		return fmt.Errorf("invalid umask %o", *p.Umask)
+	}
+
+	err = p.Output.validate()
+	if err != nil {
+		return err
+	}
+
+	err = p.Health.validate()
+	if err != nil {
+		return err
+	}
+
+	switch p.Mode {
+	case ModeDaemon, ModeOneshot:
+		if p.Schedule != "" {
+			return errors.New("schedule only applies to cron mode")
+		}
+	case ModeCron:
+		sched, err := parseSchedule(p.Schedule)
+		if err != nil {
+			return err
+		}
+		if sched.next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule %q never fires", p.Schedule)
+		}
+	default:
+		return fmt.Errorf("invalid run mode %v", p.Mode)
+	}
+
+	if p.Overlap > OverlapQueue {
+		return fmt.Errorf("invalid overlap policy %v", p.Overlap)
+	}
+
+	for _, l := range p.Rlimits {
+		_, err := rlimitResource(l.Resource)
+		if err != nil {
+			return err
+		}
+		if l.Soft > l.Hard {
+			return fmt.Errorf("soft limit of %v is greater than hard limit", l.Resource)
+		}
+	}
+
+	return nil
+}
+
+var (
+	errEmptyCmd         = errors.New("empty command")
+	errUmaskUnsupported = errors.New("umask not supported on this platform")
+)
+
+func newCmd(proc Proc) (*exec.Cmd, error) {
+	cmd := exec.Command(proc.Path, proc.Args...)
+	cmd.Dir = proc.Dir
+
+	if proc.ClearEnv {
+		cmd.Env = append([]string{}, proc.Env...)
+	} else if len(proc.Env) > 0 {
+		// For duplicate keys, the last one takes effect.
+		cmd.Env = append(os.Environ(), proc.Env...)
+	}
+
+	setProcGroup(cmd)
+
+	cred, err := credential(proc.User, proc.Group)
+	if err != nil {
+		return nil, err
+	}
+	setCredential(cmd, cred)
+
+	return cmd, nil
+}
+
+// Start the process with umask and resource limits.
+func startCmd(cmd *exec.Cmd, proc Proc) error {
+	return withUmask(proc.Umask, func() error {
+		return startRlimited(cmd, proc.Rlimits)
+	})
+}
+
+const defStopTimeout = time.Second * 10
+
+// Run the process until it exits or ctx.Done channel is closed.
+// The process is run in a new process group. Once the process exits, the remaining processes in the group are killed, so that grandchildren do not leak.
+// When ctx.Done channel is closed, StopSignal is sent to the process group, and SIGKILL is sent if the process does not exit in StopTimeout.
+// The same applies if the process is deemed unhealthy and Health.Restart is true, in which case errUnhealthy is returned.
+func startChild(ctx context.Context, c *child) error {
+	proc := c.Proc
+
+	cmd, err := newCmd(proc)
+	if err != nil {
+		return err
+	}
+
+	pipes, err := c.out.attach(cmd)
+	if err != nil {
+		return err
+	}
+	// Run last, i.e. after the process group is killed.
+	defer pipes.close()
+
+	err = startCmd(cmd, proc)
+	pipes.started()
+	if err != nil {
+		return err
+	}
+
+	atomic.StoreInt64(&c.pid, int64(cmd.Process.Pid))
+	defer atomic.StoreInt64(&c.pid, 0)
+
+	started := time.Now()
+	defer func() {
+		logExit(proc.Tag, cmd, time.Since(started))
+	}()
+
+	chWait := make(chan error, 1)
+	go func() {
+		chWait <- cmd.Wait()
+	}()
+
+	hctx, hcancel := context.WithCancel(ctx)
+	chUnhealthy := make(chan struct{})
+	chHealthDone := make(chan struct{})
+	go func() {
+		defer close(chHealthDone)
+		c.checkHealth(hctx, chUnhealthy)
+	}()
+	defer func() {
+		hcancel()
+		<-chHealthDone
+		// A oneshot process stays healthy once succeeded.
+		if c.Mode != ModeOneshot {
+			c.setHealthy(false)
+		}
+	}()
+
+	var stopErr error
+	select {
+	case err := <-chWait:
+		_ = signalGroup(cmd.Process, syscall.SIGKILL)
+		return err
+	case <-ctx.Done():
+	case <-chUnhealthy:
+		stopErr = errUnhealthy
+	}
+
+	sig := proc.StopSignal
+	if sig == 0 {
+		sig = syscall.SIGTERM
+	}
+
+	dur := proc.StopTimeout
+	if dur <= 0 {
+		dur = defStopTimeout
+	}
+
+	_ = signalGroup(cmd.Process, sig)
+
+	timer := time.NewTimer(dur)
+	defer timer.Stop()
+
+	select {
+	case err = <-chWait:
+	case <-timer.C:
+		_ = signalGroup(cmd.Process, syscall.SIGKILL)
+		err = <-chWait
+	}
+
+	_ = signalGroup(cmd.Process, syscall.SIGKILL)
+	if stopErr != nil {
+		return stopErr
+	}
+	return err
+}
+
+// Log exit code and duration of the process.
+func logExit(tag string, cmd *exec.Cmd, dur time.Duration) {
+	lg := log.WithTag(tag)
+	dur = dur.Round(time.Millisecond)
+
+	st := cmd.ProcessState
+	if st == nil {
+		return
+	}
+
+	if st.Success() {
+		lg.Info("exited with code 0 after %v", dur)
+		return
+	}
+
+	if code := st.ExitCode(); code >= 0 {
+		lg.Warn("exited with code %v after %v", code, dur)
+		return
+	}
+
+	lg.Warn("exited (%v) after %v", st, dur)
+}
@@ -0,0 +1,42 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	umask := fs.FileMode(01000)
+	notDir := filepath.Join(t.TempDir(), "notDir")
+
+	tcs := []Proc{
+		{},
+		{Path: "a", Env: []string{"noEqualSign"}},
+		{Path: "a", Dir: notDir},
+		{Path: "a", User: "noSuchUser-oEZtb"},
+		{Path: "a", Group: "noSuchGroup-oEZtb"},
+		{Path: "a", Umask: &umask},
+		{Path: "a", Rlimits: []Rlimit{{Resource: "noSuchResource"}}},
+		{Path: "a", Rlimits: []Rlimit{{Resource: "nofile", Soft: 2, Hard: 1}}},
+	}
+
+	for i, tc := range tcs {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			require.Error(t, tc.Validate())
+		})
+	}
+
+	require.Nil(t, Proc{Path: "a", Env: []string{"k=v"}, Dir: t.TempDir()}.Validate())
+}
@@ -0,0 +1,134 @@
+//go:build !windows
+
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// Run the process in a new process group, whose id is the pid of the process.
+func setProcGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Send the signal to the process group of the process.
+func signalGroup(p *os.Process, sig syscall.Signal) error {
+	return syscall.Kill(-p.Pid, sig)
+}
+
+// Resolve the user and group to run a process as. Return nil if neither is specified.
+func credential(usr, group string) (*syscall.Credential, error) {
+	if len(usr) == 0 && len(group) == 0 {
+		return nil, nil
+	}
+
+	cred := &syscall.Credential{
+		Uid: uint32(os.Getuid()),
+		Gid: uint32(os.Getgid()),
+	}
+
+	if len(usr) > 0 {
+		u, err := lookupUser(usr)
+		if err != nil {
+			return nil, err
+		}
+
+		uid, err := strconv.ParseUint(u.Uid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		gid, err := strconv.ParseUint(u.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Uid, cred.Gid = uint32(uid), uint32(gid)
+
+		// supplementary groups
+		gids, _ := u.GroupIds()
+		for _, v := range gids {
+			id, err := strconv.ParseUint(v, 10, 32)
+			if err == nil {
+				cred.Groups = append(cred.Groups, uint32(id))
+			}
+		}
+	}
+
+	if len(group) > 0 {
+		g, err := lookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+
+		gid, err := strconv.ParseUint(g.Gid, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		cred.Gid = uint32(gid)
+	}
+
+	return cred, nil
+}
+
+// Lookup a user by name, or by uid if numeric.
+func lookupUser(usr string) (*user.User, error) {
+	if _, err := strconv.ParseUint(usr, 10, 32); err == nil {
+		return user.LookupId(usr)
+	}
+
+	return user.Lookup(usr)
+}
+
+// Lookup a group by name, or by gid if numeric.
+func lookupGroup(group string) (*user.Group, error) {
+	if _, err := strconv.ParseUint(group, 10, 32); err == nil {
+		return user.LookupGroupId(group)
+	}
+
+	return user.LookupGroup(group)
+}
+
+func setCredential(cmd *exec.Cmd, cred *syscall.Credential) {
+	if cred == nil {
+		return
+	}
+
+	cmd.SysProcAttr.Credential = cred
+}
+
+const umaskSupported = true
+
+// Umask is process-wide, so process starting is serialized, in order that the umask takes effect on the right process.
+var umaskMu sync.Mutex
+
+// Call fn with umask set, and restore the umask afterwards.
+func withUmask(umask *fs.FileMode, fn func() error) error {
+	umaskMu.Lock()
+	defer umaskMu.Unlock()
+
+	if umask == nil {
+		return fn()
+	}
+
+	old := syscall.Umask(int(*umask))
+	defer syscall.Umask(old)
+
+	return fn()
+}
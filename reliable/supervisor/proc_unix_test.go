@@ -0,0 +1,219 @@
+//go:build !windows
+
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopSignal(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second/5)
+	defer cancel()
+
+	start := time.Now()
+	startChild(ctx, &child{Proc: Proc{
+		Path:       "/bin/sh",
+		Args:       []string{"-c", "trap 'echo int > " + pa + "; exit 0' INT; while true; do sleep 0.01; done"},
+		StopSignal: syscall.SIGINT,
+	}})
+	as.Less(time.Since(start), time.Second)
+
+	content, err := os.ReadFile(pa)
+	as.Nil(err)
+	as.Equal("int\n", string(content))
+}
+
+func TestStopTimeout(t *testing.T) {
+	as := require.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+	defer cancel()
+
+	start := time.Now()
+	err := startChild(ctx, &child{Proc: Proc{
+		Path:        "/bin/sh",
+		Args:        []string{"-c", "trap '' TERM; while true; do sleep 0.01; done"},
+		StopTimeout: time.Second / 5,
+	}})
+	as.Error(err)
+
+	dur := time.Since(start)
+	as.GreaterOrEqual(dur, time.Second*3/10)
+	as.Less(dur, time.Second)
+}
+
+func TestKillGroup(t *testing.T) {
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "pid")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second/5)
+	defer cancel()
+
+	startChild(ctx, &child{Proc: Proc{
+		Path: "/bin/sh",
+		Args: []string{"-c", "sleep 100 & echo $! > " + pa + "; wait"},
+	}})
+
+	content, err := os.ReadFile(pa)
+	as.Nil(err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	as.Nil(err)
+
+	as.Eventually(func() bool {
+		return !alive(pid)
+	}, time.Second, time.Millisecond*10)
+}
+
+// Zombie processes are treated as dead, since init may not reap them in time.
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil { // no procfs
+		return true
+	}
+
+	// format: pid (comm) state ...
+	i := strings.LastIndexByte(string(stat), ')')
+	return i < 0 || i+2 >= len(stat) || stat[i+2] != 'Z'
+}
+
+// Run the shell script, and return its output.
+func runSh(t *testing.T, proc Proc, script string) string {
+	as := require.New(t)
+
+	dir := proc.Dir
+	if len(dir) == 0 {
+		dir = t.TempDir()
+	}
+
+	pa := filepath.Join(dir, "out")
+	proc.Path = "/bin/sh"
+	proc.Args = []string{"-c", "exec > " + pa + "; " + script}
+	as.Nil(proc.Validate())
+
+	as.Nil(startChild(context.Background(), &child{Proc: proc}))
+
+	content, err := os.ReadFile(pa)
+	as.Nil(err)
+	return strings.TrimSpace(string(content))
+}
+
+func TestEnv(t *testing.T) {
+	as := require.New(t)
+
+	t.Setenv("GX_TEST_A", "a")
+	t.Setenv("GX_TEST_B", "b")
+
+	out := runSh(t, Proc{Env: []string{"GX_TEST_B=b2", "GX_TEST_C=c"}}, "echo $GX_TEST_A $GX_TEST_B $GX_TEST_C")
+	as.Equal("a b2 c", out)
+
+	out = runSh(t, Proc{Env: []string{"GX_TEST_C=c"}, ClearEnv: true}, "echo $GX_TEST_A $GX_TEST_B $GX_TEST_C")
+	as.Equal("c", out)
+}
+
+func TestDir(t *testing.T) {
+	as := require.New(t)
+
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	as.Nil(err)
+
+	out := runSh(t, Proc{Dir: dir}, "pwd")
+	as.Equal(dir, out)
+}
+
+func TestUmask(t *testing.T) {
+	as := require.New(t)
+
+	umask := fs.FileMode(0027)
+	out := runSh(t, Proc{Umask: &umask}, "umask")
+	as.Equal("0027", out)
+}
+
+func TestUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("requires root")
+	}
+	as := require.New(t)
+
+	// accessible to others
+	dir, err := os.MkdirTemp("", "gx")
+	as.Nil(err)
+	defer os.RemoveAll(dir)
+	as.Nil(os.Chmod(dir, 0777))
+
+	out := runSh(t, Proc{User: "65534", Group: "65534", Dir: dir}, "id -u; id -g")
+	as.Equal("65534\n65534", out)
+}
+
+// A grandchild keeping stdout open must not delay the exit of the process.
+func TestGrandchildHoldsOutput(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	pa := filepath.Join(t.TempDir(), "pid")
+	proc := Proc{
+		Tag:  "a",
+		Path: "/bin/sh",
+		Args: []string{"-c", "echo a1; sleep 20 & echo $! > " + pa + "; exit 3"},
+	}
+	out, err := openOutput(proc)
+	as.Nil(err)
+
+	start := time.Now()
+	err = startChild(context.Background(), &child{Proc: proc, out: out})
+	as.Error(err)
+	as.Less(time.Since(start), time.Second)
+	as.Equal([]string{"a1"}, out.tail.last(10))
+
+	content, err := os.ReadFile(pa)
+	as.Nil(err)
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	as.Nil(err)
+	as.Eventually(func() bool {
+		return !alive(pid)
+	}, time.Second, time.Millisecond*10)
+
+	// restarted by a Group
+	g, err := NewGroup(Proc{Tag: "b", Path: "/bin/sh", Args: []string{"-c", "sleep 20 & exit 3"}})
+	as.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(ctx)
+	}()
+
+	as.Eventually(func() bool {
+		return g.Status()[0].Restarts > 0
+	}, time.Second*2, time.Millisecond*10)
+
+	cancel()
+	as.Nil(<-done)
+}
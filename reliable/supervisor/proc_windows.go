@@ -0,0 +1,46 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// Windows has no process group in the Unix sense. So, nothing to do.
+func setProcGroup(cmd *exec.Cmd) {}
+
+// Windows does not support sending signals other than kill. So, kill the process whatever the signal is.
+func signalGroup(p *os.Process, _ syscall.Signal) error {
+	return p.Kill()
+}
+
+type credentialT struct{}
+
+// Running a process as another user is not supported on Windows.
+func credential(usr, group string) (*credentialT, error) {
+	if len(usr) == 0 && len(group) == 0 {
+		return nil, nil
+	}
+
+	return nil, errCredentialUnsupported
+}
+
+var errCredentialUnsupported = errors.New("user/group not supported on this platform")
+
+func setCredential(cmd *exec.Cmd, cred *credentialT) {}
+
+const umaskSupported = false
+
+func withUmask(_ *fs.FileMode, fn func() error) error {
+	return fn()
+}
@@ -0,0 +1,112 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+var rlimitResources = map[string]int{
+	"as":     syscall.RLIMIT_AS,
+	"core":   syscall.RLIMIT_CORE,
+	"cpu":    syscall.RLIMIT_CPU,
+	"data":   syscall.RLIMIT_DATA,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"stack":  syscall.RLIMIT_STACK,
+}
+
+func rlimitResource(name string) (int, error) {
+	res, ok := rlimitResources[name]
+	if !ok {
+		return 0, fmt.Errorf("invalid rlimit resource %v", name)
+	}
+
+	return res, nil
+}
+
+// Start the process with resource limits applied before it runs its first instruction.
+// The process is started under ptrace, so that it stops right after exec. Then the limits are set, and the process is detached.
+func startRlimited(cmd *exec.Cmd, limits []Rlimit) error {
+	if len(limits) == 0 {
+		return cmd.Start()
+	}
+
+	// The thread which starts the process is the tracer, and ptrace requests must come from it.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Ptrace = true
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	err = applyRlimits(cmd.Process.Pid, limits)
+	if err != nil {
+		_ = signalGroup(cmd.Process, syscall.SIGKILL)
+		_ = cmd.Wait()
+		return err
+	}
+
+	return nil
+}
+
+// Wait for the traced process of pid to stop after exec, set its resource limits, and detach it.
+func applyRlimits(pid int, limits []Rlimit) error {
+	var ws syscall.WaitStatus
+	_, err := syscall.Wait4(pid, &ws, 0, nil)
+	if err != nil {
+		return err
+	}
+	if !ws.Stopped() {
+		return fmt.Errorf("process not stopped after exec: %v", ws)
+	}
+
+	err = setRlimits(pid, limits)
+	if err != nil {
+		return err
+	}
+
+	return syscall.PtraceDetach(pid)
+}
+
+// Set resource limits of the process of pid.
+func setRlimits(pid int, limits []Rlimit) error {
+	for _, l := range limits {
+		res, err := rlimitResource(l.Resource)
+		if err != nil {
+			return err
+		}
+
+		err = prlimit(pid, res, &syscall.Rlimit{Cur: l.Soft, Max: l.Hard})
+		if err != nil {
+			return fmt.Errorf("error setting rlimit %v: %w", l.Resource, err)
+		}
+	}
+
+	return nil
+}
+
+func prlimit(pid int, resource int, lim *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource), uintptr(unsafe.Pointer(lim)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRlimits(t *testing.T) {
+	as := require.New(t)
+
+	// The limits apply before the process runs, i.e. no delay needed.
+	out := runSh(t, Proc{Rlimits: []Rlimit{{Resource: "nofile", Soft: 100, Hard: 200}}}, "ulimit -Sn; ulimit -Hn")
+	as.Equal("100\n200", out)
+}
+
+func TestRlimitsError(t *testing.T) {
+	as := require.New(t)
+
+	// Bypass Validate, so that setting the limits fails after the process starts.
+	proc := Proc{Path: "/bin/sh", Args: []string{"-c", "sleep 10"}, Rlimits: []Rlimit{{Resource: "nofile", Soft: 200, Hard: 100}}}
+	start := time.Now()
+	as.Error(startChild(context.Background(), &child{Proc: proc}))
+	as.Less(time.Since(start), time.Second)
+}
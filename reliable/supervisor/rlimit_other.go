@@ -0,0 +1,31 @@
+//go:build !linux
+
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package supervisor
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Setting resource limits of another process is only supported on Linux.
+func rlimitResource(string) (int, error) {
+	return 0, errRlimitUnsupported
+}
+
+var errRlimitUnsupported = errors.New("rlimits not supported on this platform")
+
+func startRlimited(cmd *exec.Cmd, limits []Rlimit) error {
+	if len(limits) > 0 {
+		return errRlimitUnsupported
+	}
+
+	return cmd.Start()
+}
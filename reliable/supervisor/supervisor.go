@@ -11,61 +11,45 @@ package supervisor
 import (
 	"context"
 	"errors"
-	"os/exec"
-	"sync"
-
-	"github.com/burningxflame/gx/reliable/backoff"
-	"github.com/burningxflame/gx/reliable/guard"
 )
 
-type Proc struct {
-	Tag  string       // Used to tag log messages
-	Path string       // Path of the command to run
-	Args []string     // Args of the command
-	Bf   backoff.Conf // Backoff strategy determines how long to wait between retries
-}
-
 // Start and guard processes until ctx.Done channel is closed.
+// Use Group instead, if processes need to be controlled at runtime.
 func Supervisor(ctx context.Context, procs ...Proc) error {
-	if len(procs) < 1 {
-		return errNoProc
+	g, err := NewGroup(procs...)
+	if err != nil {
+		return err
 	}
 
-	for _, proc := range procs {
-		if len(proc.Path) < 1 {
-			return errEmptyCmd
-		}
-	}
-
-	var wg sync.WaitGroup
-
-	for _, proc := range procs {
-		proc := proc
+	return g.Run(ctx)
+}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
+// Validate procs as a group, i.e. each proc, uniqueness of tags, and dependencies among procs.
+// Return the first error found.
+func Validate(procs ...Proc) error {
+	return validateProcs(procs)
+}
 
-			guard.WithGuard(ctx, guard.Conf{
-				Tag: proc.Tag,
-				Fn: func(ctx context.Context) error {
-					return startChild(ctx, proc.Path, proc.Args)
-				},
-				Bf:                 proc.Bf,
-				AlsoRetryOnSuccess: true,
-			})
-		}()
-	}
+// Validate procs as a group like Validate, but return all errors found, ordered by proc index.
+// Each error is a *ProcError, except the one returned if there is no proc.
+func ValidateAll(procs ...Proc) []error {
+	return validateAll(procs)
+}
 
-	wg.Wait()
-	return nil
+// An error of a proc in a group
+type ProcError struct {
+	Index int    // Index of the proc in the group
+	Tag   string // Tag of the proc
+	Err   error
 }
 
-var (
-	errNoProc   = errors.New("no proc")
-	errEmptyCmd = errors.New("empty command")
-)
+// Return the message of Err.
+func (e *ProcError) Error() string {
+	return e.Err.Error()
+}
 
-func startChild(ctx context.Context, program string, args []string) error {
-	return exec.CommandContext(ctx, program, args...).Run()
+func (e *ProcError) Unwrap() error {
+	return e.Err
 }
+
+var errNoProc = errors.New("no proc")
@@ -0,0 +1,312 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+// Supervision Tree. A supervisor starts, stops and restarts its children, i.e. goroutine workers and child supervisors.
+package suptree
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/backoff"
+)
+
+type Conf struct {
+	// Children are started in order, and stopped in reverse order.
+	Children []Child
+	// Determines which children are restarted when a child exits. Default to OneForOne.
+	Strategy Strategy
+	// If more than MaxRestarts restarts occur in Period, stop all children and return ErrTooManyRestarts.
+	// Default to no limit.
+	MaxRestarts int
+	// See MaxRestarts. Default to 5s.
+	Period time.Duration
+	// Backoff strategy determines how long to wait before restarting.
+	Bf backoff.Conf
+	// Used to tag log messages
+	Tag string
+	// A TagLogger used to log messages
+	Log log.TagLogger
+}
+
+// A child of a supervisor
+type Child struct {
+	// Used to tag log messages
+	Tag string
+	// The func to be supervised. Use Supervisor.Run to supervise a child supervisor.
+	// Fn should return ASAP when ctx.Done channel is closed, which usually means an exit signal is sent.
+	Fn func(ctx context.Context) error
+	// Determines whether the child is restarted when it exits. Default to Permanent.
+	Restart Restart
+}
+
+// Restart strategy of a supervisor
+type Strategy byte
+
+const (
+	// Restart the exited child only.
+	OneForOne Strategy = iota
+	// Stop all other children, then restart all children.
+	OneForAll
+	// Stop children started after the exited child, then restart the exited child and those children.
+	RestForOne
+)
+
+// Restart policy of a child
+type Restart byte
+
+const (
+	// Always restart
+	Permanent Restart = iota
+	// Restart only if the child exits with a non-nil error
+	Transient
+	// Never restart
+	Temporary
+)
+
+var ErrTooManyRestarts = errors.New("too many restarts")
+
+// Supervisor starts and supervises children.
+type Supervisor struct {
+	cf Conf
+	lg log.TagLogger
+}
+
+// Create a Supervisor.
+func New(cf Conf) *Supervisor {
+	if cf.Strategy > RestForOne {
+		cf.Strategy = OneForOne
+	}
+
+	if cf.Period <= 0 {
+		cf.Period = time.Second * 5
+	}
+
+	if cf.Log == nil {
+		cf.Log = log.WithTag("")
+	}
+
+	return &Supervisor{
+		cf: cf,
+		lg: cf.Log.WithTag("supervisor " + cf.Tag),
+	}
+}
+
+type child struct {
+	Child
+	cancel  context.CancelFunc
+	done    chan struct{}
+	gen     int
+	running bool
+	// exited and will not be restarted
+	finished bool
+}
+
+type exit struct {
+	idx int
+	gen int
+	err error
+}
+
+// Start children, and supervise them until ctx.Done channel is closed, or the restart intensity is exceeded.
+// Return nil if ctx.Done channel is closed or all children exit without restarting, ErrTooManyRestarts if the restart intensity is exceeded.
+// Run can be used as the Fn of a parent Supervisor or a guard.
+func (s *Supervisor) Run(ctx context.Context) error {
+	lg := s.lg
+	lg.Info("starting")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	children := make([]*child, len(s.cf.Children))
+	for i, c := range s.cf.Children {
+		children[i] = &child{Child: c}
+	}
+
+	exits := make(chan exit)
+
+	start := func(i int) {
+		c := children[i]
+		// Children are stopped by the supervisor one by one in reverse order, rather than all at once on ctx cancellation.
+		cctx, ccancel := context.WithCancel(detached{ctx})
+		c.cancel = ccancel
+		c.done = make(chan struct{})
+		c.gen++
+		c.running = true
+
+		gen, done := c.gen, c.done
+		go func() {
+			err := c.Fn(cctx)
+			close(done)
+
+			select {
+			case exits <- exit{i, gen, err}:
+			case <-ctx.Done():
+			}
+		}()
+
+		lg.Debug("started %v", c.Tag)
+	}
+
+	stop := func(i int) {
+		c := children[i]
+		if !c.running {
+			return
+		}
+
+		c.cancel()
+		<-c.done
+		c.running = false
+
+		lg.Debug("stopped %v", c.Tag)
+	}
+
+	// stop children in [from, to) in reverse order
+	stopRange := func(from, to int) {
+		for i := to - 1; i >= from; i-- {
+			stop(i)
+		}
+	}
+	defer stopRange(0, len(children))
+
+	for i := range children {
+		start(i)
+	}
+
+	bf := backoff.New(s.cf.Bf)
+	var restarts []time.Time
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	defer timer.Stop()
+
+	for {
+		if !anyRunning(children) {
+			lg.Info("all children exited")
+			return nil
+		}
+
+		var ex exit
+		select {
+		case <-ctx.Done():
+			lg.Info("received exit signal, exiting")
+			return nil
+
+		case ex = <-exits:
+		}
+
+		c := children[ex.idx]
+		if ex.gen != c.gen || !c.running { // stopped on purpose
+			continue
+		}
+		c.running = false
+		c.cancel()
+
+		if ex.err != nil {
+			lg.Warn("%v exited because of error: %v", c.Tag, ex.err)
+		} else {
+			lg.Info("%v exited", c.Tag)
+		}
+
+		if !shouldRestart(c.Restart, ex.err) {
+			c.finished = true
+			continue
+		}
+
+		now := time.Now()
+		restarts = append(restarts, now)
+		restarts = within(restarts, now.Add(-s.cf.Period))
+		if s.cf.MaxRestarts > 0 && len(restarts) > s.cf.MaxRestarts {
+			lg.Error("more than %v restarts in %v, exiting", s.cf.MaxRestarts, s.cf.Period)
+			return ErrTooManyRestarts
+		}
+
+		from, to := ex.idx, ex.idx+1
+		switch s.cf.Strategy {
+		case OneForAll:
+			from, to = 0, len(children)
+		case RestForOne:
+			to = len(children)
+		}
+
+		stopRange(from, to)
+
+		dur := bf.Next()
+		lg.Warn("restart %v in %v", c.Tag, dur)
+
+		timer.Reset(dur)
+		select {
+		case <-ctx.Done():
+			lg.Info("received exit signal, exiting")
+			return nil
+		case <-timer.C:
+		}
+
+		for i := from; i < to; i++ {
+			if i != ex.idx && children[i].Restart == Temporary {
+				children[i].finished = true
+			}
+
+			if !children[i].finished {
+				start(i)
+			}
+		}
+	}
+}
+
+func shouldRestart(r Restart, err error) bool {
+	switch r {
+	case Transient:
+		return err != nil
+	case Temporary:
+		return false
+	default:
+		return true
+	}
+}
+
+func anyRunning(children []*child) bool {
+	for _, c := range children {
+		if c.running {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A context which carries values of the parent, but is never cancelled with the parent.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
+
+// Drop times before since. Times are in ascending order.
+func within(l []time.Time, since time.Time) []time.Time {
+	i := 0
+	for i < len(l) && l[i].Before(since) {
+		i++
+	}
+
+	return l[i:]
+}
@@ -0,0 +1,272 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package suptree
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/backoff"
+)
+
+var bf = backoff.Conf{
+	Min:        time.Millisecond,
+	Max:        time.Millisecond,
+	Unit:       time.Millisecond,
+	Strategy:   backoff.Linear,
+	ResetAfter: time.Millisecond * 100,
+}
+
+var errDummy = errors.New("dummy")
+
+// Record starts and stops of children
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+	starts map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{starts: make(map[string]int)}
+}
+
+func (r *recorder) add(event, tag string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event+" "+tag)
+	if event == "start" {
+		r.starts[tag]++
+	}
+}
+
+func (r *recorder) nStarts(tag string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.starts[tag]
+}
+
+// A child runs until ctx.Done channel is closed.
+func (r *recorder) worker(tag string) Child {
+	return Child{
+		Tag: tag,
+		Fn: func(ctx context.Context) error {
+			r.add("start", tag)
+			<-ctx.Done()
+			r.add("stop", tag)
+			return nil
+		},
+	}
+}
+
+// A child fails the first n runs, then runs until ctx.Done channel is closed.
+func (r *recorder) failFirst(tag string, n int) Child {
+	return Child{
+		Tag: tag,
+		Fn: func(ctx context.Context) error {
+			r.add("start", tag)
+			if r.nStarts(tag) <= n {
+				r.add("stop", tag)
+				return errDummy
+			}
+
+			<-ctx.Done()
+			r.add("stop", tag)
+			return nil
+		},
+	}
+}
+
+func runFor(s *Supervisor, dur time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dur)
+	defer cancel()
+
+	return s.Run(ctx)
+}
+
+func TestStrategies(t *testing.T) {
+	light.InitTestLog()
+
+	tcs := []struct {
+		strategy Strategy
+		expect   []int // expected number of starts of a, b, c
+	}{
+		{OneForOne, []int{1, 3, 1}},
+		{OneForAll, []int{3, 3, 3}},
+		{RestForOne, []int{1, 3, 3}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(strconv.Itoa(int(tc.strategy)), func(t *testing.T) {
+			as := require.New(t)
+			r := newRecorder()
+
+			s := New(Conf{
+				Tag: "dummy",
+				Children: []Child{
+					r.worker("a"),
+					r.failFirst("b", 2),
+					r.worker("c"),
+				},
+				Strategy: tc.strategy,
+				Bf:       bf,
+			})
+			as.Nil(runFor(s, time.Second/10))
+
+			for i, tag := range []string{"a", "b", "c"} {
+				as.Equal(tc.expect[i], r.nStarts(tag), tag)
+			}
+		})
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	r := newRecorder()
+
+	s := New(Conf{
+		Tag: "dummy",
+		Children: []Child{
+			r.worker("a"),
+			r.worker("b"),
+			r.worker("c"),
+		},
+	})
+	as.Nil(runFor(s, time.Second/10))
+
+	var stops []string
+	for _, e := range r.events {
+		if strings.HasPrefix(e, "stop") {
+			stops = append(stops, e)
+		}
+	}
+	as.Equal([]string{"stop c", "stop b", "stop a"}, stops)
+}
+
+func TestRestartPolicies(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	r := newRecorder()
+	once := func(tag string, err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			r.add("start", tag)
+			if r.nStarts(tag) == 1 {
+				return err
+			}
+			<-ctx.Done()
+			return nil
+		}
+	}
+
+	s := New(Conf{
+		Tag: "dummy",
+		Children: []Child{
+			{Tag: "permanent", Fn: once("permanent", nil)},
+			{Tag: "transientOk", Fn: once("transientOk", nil), Restart: Transient},
+			{Tag: "transientErr", Fn: once("transientErr", errDummy), Restart: Transient},
+			{Tag: "temporary", Fn: once("temporary", errDummy), Restart: Temporary},
+		},
+		Bf: bf,
+	})
+	as.Nil(runFor(s, time.Second/10))
+
+	as.Equal(2, r.nStarts("permanent"))
+	as.Equal(1, r.nStarts("transientOk"))
+	as.Equal(2, r.nStarts("transientErr"))
+	as.Equal(1, r.nStarts("temporary"))
+}
+
+func TestAllExited(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	s := New(Conf{
+		Tag: "dummy",
+		Children: []Child{
+			{Tag: "a", Fn: func(context.Context) error { return nil }, Restart: Transient},
+			{Tag: "b", Fn: func(context.Context) error { return errDummy }, Restart: Temporary},
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	as.Nil(s.Run(ctx))
+	as.Nil(ctx.Err())
+}
+
+func TestIntensity(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	r := newRecorder()
+
+	s := New(Conf{
+		Tag: "dummy",
+		Children: []Child{
+			r.worker("a"),
+			r.failFirst("b", 100),
+		},
+		MaxRestarts: 3,
+		Period:      time.Second,
+		Bf:          bf,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	as.ErrorIs(s.Run(ctx), ErrTooManyRestarts)
+	as.Nil(ctx.Err())
+	as.Equal(4, r.nStarts("b"))
+	as.Equal("stop a", r.events[len(r.events)-1])
+}
+
+func TestNested(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	r := newRecorder()
+
+	sub := New(Conf{
+		Tag: "sub",
+		Children: []Child{
+			r.failFirst("c", 100),
+		},
+		MaxRestarts: 1,
+		Bf:          bf,
+	})
+
+	s := New(Conf{
+		Tag: "root",
+		Children: []Child{
+			r.worker("a"),
+			{Tag: "sub", Fn: sub.Run},
+		},
+		Strategy: OneForAll,
+		Bf:       bf,
+	})
+
+	as.Nil(runFor(s, time.Second/10))
+
+	// sub exceeds its restart intensity, and therefore root restarts all
+	as.Greater(r.nStarts("a"), 1)
+	as.Greater(r.nStarts("c"), r.nStarts("a"))
+}
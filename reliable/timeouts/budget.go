@@ -0,0 +1,123 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package timeouts
+
+import (
+	"context"
+	"time"
+)
+
+// Return the time left before the deadline of ctx. ok is false if ctx has no deadline.
+// The time left is 0 if the deadline has passed.
+func Remaining(ctx context.Context) (left time.Duration, ok bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+
+	left = time.Until(deadline)
+	if left < 0 {
+		left = 0
+	}
+	return left, true
+}
+
+// Return a timeout which is frac (0, 1] of the time left before the deadline of ctx, capped by max if max > 0.
+// E.g. Budget(ctx, 0.2, 0) means "at most 20% of what's left".
+// If ctx has no deadline, return max, and therefore 0, i.e. no timeout, if max <= 0 too.
+// If the deadline has passed, return a tiny timeout, so that calls time out at once.
+func Budget(ctx context.Context, frac float64, max time.Duration) time.Duration {
+	left, ok := Remaining(ctx)
+	if !ok {
+		return max
+	}
+
+	if frac <= 0 || frac > 1 {
+		frac = 1
+	}
+
+	d := time.Duration(float64(left) * frac)
+	if max > 0 && d > max {
+		d = max
+	}
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return d
+}
+
+// Return a copy of ctx whose deadline is Budget(ctx, frac, max) from now.
+// The deadline never exceeds that of ctx, so chained steps never exceed an overall deadline.
+func BudgetContext(ctx context.Context, frac float64, max time.Duration) (context.Context, context.CancelFunc) {
+	d := Budget(ctx, frac, max)
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, d)
+}
+
+// Budget Decorator for functions with input and output parameters, i.e func(ctx, I) (O, error).
+// Same as WithTimeoutCtxIO, except that the timeout of each call is Budget(ctx, frac, max).
+func WithBudgetIO[I, O any](frac float64, max time.Duration, tr *Tracker, fn func(context.Context, I) (O, error)) func(context.Context, I) (O, error) {
+	if tr == nil {
+		tr = DefaultTracker
+	}
+
+	return func(ctx context.Context, in I) (O, error) {
+		timeout := Budget(ctx, frac, max)
+		if timeout <= 0 {
+			return fn(ctx, in)
+		}
+
+		return callCtx(ctx, timeout, tr, fn, in)
+	}
+}
+
+// Budget Decorator for functions with input parameters only, i.e func(ctx, I) error
+func WithBudgetI[I any](frac float64, max time.Duration, tr *Tracker, fn func(context.Context, I) error) func(context.Context, I) error {
+	fn1 := func(ctx context.Context, in I) (none, error) {
+		err := fn(ctx, in)
+		return none{}, err
+	}
+
+	fn2 := WithBudgetIO(frac, max, tr, fn1)
+
+	return func(ctx context.Context, in I) error {
+		_, err := fn2(ctx, in)
+		return err
+	}
+}
+
+// Budget Decorator for functions with output parameters only, i.e func(ctx) (O, error)
+func WithBudgetO[O any](frac float64, max time.Duration, tr *Tracker, fn func(context.Context) (O, error)) func(context.Context) (O, error) {
+	fn1 := func(ctx context.Context, _ none) (O, error) {
+		return fn(ctx)
+	}
+
+	fn2 := WithBudgetIO(frac, max, tr, fn1)
+
+	return func(ctx context.Context) (O, error) {
+		return fn2(ctx, none{})
+	}
+}
+
+// Budget Decorator for functions with neither input nor output parameters, i.e func(ctx) error
+func WithBudget(frac float64, max time.Duration, tr *Tracker, fn func(context.Context) error) func(context.Context) error {
+	fn1 := func(ctx context.Context, _ none) (none, error) {
+		return none{}, fn(ctx)
+	}
+
+	fn2 := WithBudgetIO(frac, max, tr, fn1)
+
+	return func(ctx context.Context) error {
+		_, err := fn2(ctx, none{})
+		return err
+	}
+}
@@ -0,0 +1,81 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package timeouts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	as := require.New(t)
+
+	// no deadline
+	as.Equal(time.Duration(0), Budget(context.Background(), 0.2, 0))
+	as.Equal(time.Second, Budget(context.Background(), 0.2, time.Second))
+	_, ok := Remaining(context.Background())
+	as.False(ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	left, ok := Remaining(ctx)
+	as.True(ok)
+	as.InDelta(time.Second, left, float64(time.Millisecond*100))
+
+	as.InDelta(time.Second/5, Budget(ctx, 0.2, 0), float64(time.Millisecond*20))
+	as.Equal(time.Millisecond*10, Budget(ctx, 0.2, time.Millisecond*10))
+	// invalid frac
+	as.InDelta(time.Second, Budget(ctx, 2, 0), float64(time.Millisecond*100))
+
+	// deadline passed
+	expired, cancel2 := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel2()
+	as.Equal(time.Nanosecond, Budget(expired, 0.2, 0))
+
+	sub, cancel3 := BudgetContext(ctx, 0.5, 0)
+	defer cancel3()
+	left, _ = Remaining(sub)
+	as.InDelta(time.Second/2, left, float64(time.Millisecond*100))
+}
+
+func TestWithBudget(t *testing.T) {
+	as := require.New(t)
+
+	sleep := func(d time.Duration) func(context.Context) error {
+		return func(ctx context.Context) error {
+			select {
+			case <-time.After(d):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	// 20% of ~100ms
+	start := time.Now()
+	err := WithBudget(0.2, 0, nil, sleep(time.Millisecond*50))(ctx)
+	as.ErrorIs(err, ErrTimeout)
+	as.Less(time.Since(start), time.Millisecond*40)
+
+	as.Nil(WithBudget(0.5, 0, nil, sleep(time.Millisecond*5))(ctx))
+
+	// no deadline, no max, i.e. no timeout
+	as.Nil(WithBudget(0.2, 0, nil, sleep(time.Millisecond*5))(context.Background()))
+	// no deadline, max applied
+	err = WithBudget(0.2, time.Millisecond, nil, sleep(time.Millisecond*50))(context.Background())
+	as.ErrorIs(err, ErrTimeout)
+}
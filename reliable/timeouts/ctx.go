@@ -0,0 +1,165 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrTooManyAbandoned = errors.New("too many abandoned calls in flight")
+
+// Tracks abandoned calls, i.e. calls which timed out but have not returned yet.
+// Share a Tracker among decorators to report and cap their abandoned calls together.
+type Tracker struct {
+	// Max number of abandoned calls in flight. Once reached, calls fail with ErrTooManyAbandoned without calling fn.
+	// Running calls are not counted until abandoned, so calls already running when Max is reached may still time out and exceed it.
+	// Default to no limit.
+	Max int64
+
+	n int64
+}
+
+// Return the number of abandoned calls in flight.
+func (t *Tracker) Abandoned() int64 {
+	return atomic.LoadInt64(&t.n)
+}
+
+// Return true if new calls may run, i.e. Max is not reached.
+func (t *Tracker) allow() bool {
+	return t.Max <= 0 || t.Abandoned() < t.Max
+}
+
+// Used by decorators given a nil Tracker
+var DefaultTracker = &Tracker{}
+
+// Context-aware Timeout Decorator for functions with input and output parameters, i.e func(ctx, I) (O, error).
+// On timeout, the ctx passed to fn is cancelled, and the call is abandoned, i.e. tracked by tr until fn returns.
+// fn should return ASAP when ctx.Done channel is closed.
+// If tr is nil, DefaultTracker is used.
+func WithTimeoutCtxIO[I, O any](timeout time.Duration, tr *Tracker, fn func(context.Context, I) (O, error)) func(context.Context, I) (O, error) {
+	if timeout <= 0 {
+		return fn
+	}
+
+	if tr == nil {
+		tr = DefaultTracker
+	}
+
+	return func(ctx context.Context, in I) (O, error) {
+		return callCtx(ctx, timeout, tr, fn, in)
+	}
+}
+
+// Call fn with a ctx which is done after timeout. Abandon the call if it does not return by then.
+func callCtx[I, O any](ctx context.Context, timeout time.Duration, tr *Tracker, fn func(context.Context, I) (O, error), in I) (O, error) {
+	if !tr.allow() {
+		var out O
+		return out, ErrTooManyAbandoned
+	}
+
+	// Cancelled only after the result is classified, so that errors of fn are not mistaken for ctx errors.
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ch := make(chan result[O], 1)
+	// callRunning -> callDone if fn returns first, or callRunning -> callAbandoned if ctx is done first
+	var state int32
+
+	go func() {
+		val, err := fn(ctx, in)
+		// fn respects ctx, and returns because of it
+		if err != nil && ctx.Err() != nil {
+			err = ctxErr(ctx)
+		}
+
+		if atomic.CompareAndSwapInt32(&state, callRunning, callDone) {
+			ch <- result[O]{val, err}
+			return
+		}
+
+		atomic.AddInt64(&tr.n, -1)
+	}()
+
+	select {
+	case r := <-ch:
+		return r.val, r.err
+
+	case <-ctx.Done():
+		// Reserve a slot before abandoning, so that the count never goes negative.
+		atomic.AddInt64(&tr.n, 1)
+		if !atomic.CompareAndSwapInt32(&state, callRunning, callAbandoned) {
+			// fn returned right before.
+			atomic.AddInt64(&tr.n, -1)
+			r := <-ch
+			return r.val, r.err
+		}
+
+		var out O
+		return out, ctxErr(ctx)
+	}
+}
+
+// Return ErrTimeout if ctx deadline exceeded, or ctx.Err() otherwise.
+func ctxErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
+
+const (
+	callRunning int32 = iota
+	callDone
+	callAbandoned
+)
+
+// Context-aware Timeout Decorator for functions with input parameters only, i.e func(ctx, I) error
+func WithTimeoutCtxI[I any](timeout time.Duration, tr *Tracker, fn func(context.Context, I) error) func(context.Context, I) error {
+	fn1 := func(ctx context.Context, in I) (none, error) {
+		err := fn(ctx, in)
+		return none{}, err
+	}
+
+	fn2 := WithTimeoutCtxIO(timeout, tr, fn1)
+
+	return func(ctx context.Context, in I) error {
+		_, err := fn2(ctx, in)
+		return err
+	}
+}
+
+// Context-aware Timeout Decorator for functions with output parameters only, i.e func(ctx) (O, error)
+func WithTimeoutCtxO[O any](timeout time.Duration, tr *Tracker, fn func(context.Context) (O, error)) func(context.Context) (O, error) {
+	fn1 := func(ctx context.Context, _ none) (O, error) {
+		return fn(ctx)
+	}
+
+	fn2 := WithTimeoutCtxIO(timeout, tr, fn1)
+
+	return func(ctx context.Context) (O, error) {
+		return fn2(ctx, none{})
+	}
+}
+
+// Context-aware Timeout Decorator for functions with neither input nor output parameters, i.e func(ctx) error
+func WithTimeoutCtx(timeout time.Duration, tr *Tracker, fn func(context.Context) error) func(context.Context) error {
+	fn1 := func(ctx context.Context, _ none) (none, error) {
+		return none{}, fn(ctx)
+	}
+
+	fn2 := WithTimeoutCtxIO(timeout, tr, fn1)
+
+	return func(ctx context.Context) error {
+		_, err := fn2(ctx, none{})
+		return err
+	}
+}
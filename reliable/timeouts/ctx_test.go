@@ -0,0 +1,178 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package timeouts
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTimeoutCtxIO(t *testing.T) {
+	as := require.New(t)
+
+	timeout := time.Second / 100
+	fn := func(timeout time.Duration) func(context.Context, int) (string, error) {
+		return func(ctx context.Context, i int) (string, error) {
+			select {
+			case <-time.After(timeout):
+				return strconv.Itoa(i), nil
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+	}
+
+	tcs := []struct {
+		fn      func(context.Context, int) (string, error)
+		timeout time.Duration
+		ok      bool
+	}{
+		{fn(0), 0, true},
+		{fn(0), timeout, true},
+		{fn(timeout), 0, true},
+		{fn(timeout * 2), timeout, false},
+	}
+
+	for ti, tc := range tcs {
+		t.Run(strconv.Itoa(ti), func(t *testing.T) {
+			tr := &Tracker{}
+			fn := WithTimeoutCtxIO(tc.timeout, tr, tc.fn)
+			v, err := fn(context.Background(), 68)
+			if tc.ok {
+				as.Nil(err)
+				as.Equal(v, "68")
+			} else {
+				as.ErrorIs(err, ErrTimeout)
+			}
+
+			// fn respects ctx, so abandoned calls return soon.
+			require.Eventually(t, func() bool {
+				return tr.Abandoned() == 0
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestWithTimeoutCtxCancel(t *testing.T) {
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	fn := WithTimeoutCtx(time.Second, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+	as.ErrorIs(fn(ctx), context.Canceled)
+}
+
+func TestWithTimeoutCtxError(t *testing.T) {
+	as := require.New(t)
+
+	errReal := errors.New("real")
+	fn := WithTimeoutCtx(time.Second, nil, func(context.Context) error {
+		return errReal
+	})
+
+	// not mistaken for ctx errors
+	for i := 0; i < 10000; i++ {
+		as.Equal(errReal, fn(context.Background()))
+	}
+}
+
+func TestAbandonedMaxHealthy(t *testing.T) {
+	as := require.New(t)
+
+	const max = 2
+	tr := &Tracker{Max: max}
+	release := make(chan struct{})
+	fn := WithTimeoutCtx(time.Second, tr, func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	// Healthy calls in flight are not capped.
+	var wg sync.WaitGroup
+	errs := make(chan error, max*10)
+	for i := 0; i < max*10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- fn(context.Background())
+		}()
+	}
+	time.Sleep(time.Millisecond * 10)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		as.Nil(err)
+	}
+	as.Equal(int64(0), tr.Abandoned())
+}
+
+func TestAbandoned(t *testing.T) {
+	as := require.New(t)
+
+	timeout := time.Second / 100
+	release := make(chan struct{})
+
+	tr := &Tracker{Max: 2}
+	// ignore ctx
+	fn := WithTimeoutCtxO(timeout, tr, func(context.Context) (int, error) {
+		<-release
+		return 1, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := fn(context.Background())
+		as.ErrorIs(err, ErrTimeout)
+	}
+	as.Equal(int64(2), tr.Abandoned())
+
+	// capped
+	_, err := fn(context.Background())
+	as.ErrorIs(err, ErrTooManyAbandoned)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return tr.Abandoned() == 0
+	}, time.Second, time.Millisecond)
+
+	v, err := fn(context.Background())
+	as.Nil(err)
+	as.Equal(1, v)
+}
+
+func TestWithTimeoutCtxI(t *testing.T) {
+	as := require.New(t)
+
+	timeout := time.Second / 100
+	fn := func(ctx context.Context, d time.Duration) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	as.Nil(WithTimeoutCtxI(timeout, nil, fn)(context.Background(), 0))
+	as.ErrorIs(WithTimeoutCtxI(timeout, nil, fn)(context.Background(), timeout*2), ErrTimeout)
+}
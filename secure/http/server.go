@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/readiness"
 	"github.com/burningxflame/gx/sync/sem"
 )
 
@@ -21,11 +22,17 @@ import (
 type Server struct {
 	// http.Server in std lib
 	Std http.Server
-	// Used to limit max number of concurrent requests.
-	// Default to no limit.
-	Limiter *sem.Sem
+	// Used to limit max number of concurrent requests, e.g. sem.New(n) or sem.NewAdaptive(cf).
+	// Default to no limit. A nil interface or nil pointer means no limit.
+	Limiter sem.Limiter
 	// If graceful shutdown takes longer than ShutdownTimeout, exit instantly.
 	ShutdownTimeout time.Duration
+	// If set, MarkDraining is called on exit signal before shutting down, e.g. with a *readiness.Server,
+	// so that probes fail and no new traffic is routed here.
+	Readiness readiness.Drainer
+	// How long to wait after MarkDraining before shutting down, so that load balancers notice.
+	// Default to 0.
+	DrainDelay time.Duration
 	// Used to tag log messages
 	Tag string
 	// A TagLogger used to log messages
@@ -39,7 +46,7 @@ func (s *Server) Serve(ctx context.Context) error {
 	}
 	lg := s.Log.WithTag(s.Tag)
 
-	if s.Limiter != nil {
+	if !sem.IsNil(s.Limiter) {
 		origHandler := s.Std.Handler
 		defer func() {
 			s.Std.Handler = origHandler
@@ -62,6 +69,8 @@ func (s *Server) Serve(ctx context.Context) error {
 	case <-ctx.Done():
 		lg.Info("received exit signal, exiting")
 
+		readiness.Drain(s.Readiness, s.DrainDelay)
+
 		ctx, cancel := context.WithTimeout(ctx, s.ShutdownTimeout)
 		defer cancel()
 
@@ -74,8 +83,8 @@ func (s *Server) Serve(ctx context.Context) error {
 	}
 }
 
-func LimitHandler(ctx context.Context, limiter *sem.Sem, handler http.Handler) http.Handler {
-	if limiter == nil {
+func LimitHandler(ctx context.Context, limiter sem.Limiter, handler http.Handler) http.Handler {
+	if sem.IsNil(limiter) {
 		return handler
 	}
 
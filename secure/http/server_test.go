@@ -66,6 +66,14 @@ func TestServer(t *testing.T) {
 			cltOpt:  clientOpt{timeout: dur * 3 / 2},
 			cltOk:   9,
 		},
+		{
+			tag:     "Limiter/typedNil",
+			srv:     &Server{Limiter: nilSem},
+			srvOpt:  serverOpt{},
+			cltSize: 9,
+			cltOpt:  clientOpt{timeout: dur * 3 / 2},
+			cltOk:   9,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -92,6 +100,9 @@ type clientOpt struct {
 	timeout time.Duration
 }
 
+// A nil *sem.Sem means no limit.
+var nilSem *sem.Sem
+
 func test(t *testing.T, tc testcase) {
 	light.InitTestLog()
 	as := require.New(t)
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/readiness"
 	"github.com/burningxflame/gx/reliable/timeouts"
 	"github.com/burningxflame/gx/secure/conns"
 	"github.com/burningxflame/gx/sync/sem"
@@ -24,9 +25,9 @@ type Server struct {
 	// If graceful shutdown takes longer than ShutdownTimeout, exit instantly.
 	// Default to no timeout.
 	ShutdownTimeout time.Duration
-	// Used to limit max number of concurrent connections.
-	// Default to no limit.
-	ConnLimiter *sem.Sem
+	// Used to limit max number of concurrent connections, e.g. sem.New(n) or sem.NewAdaptive(cf).
+	// Default to no limit. A nil interface or nil pointer means no limit.
+	ConnLimiter sem.Limiter
 	// If no data is sent from a connection in the specified duration, close the connection.
 	// Default to no timeout.
 	IdleTimeout time.Duration
@@ -43,6 +44,12 @@ type Server struct {
 	// If true, the Context argument of ConnHandler contains the connection id.
 	// Call GetConnId(ctx) to get connection id.
 	CtxConnId bool
+	// If set, MarkDraining is called on exit signal before draining connections, e.g. with a *readiness.Server,
+	// so that probes fail and no new traffic is routed here.
+	Readiness readiness.Drainer
+	// How long to wait after MarkDraining before closing the listener, so that load balancers notice.
+	// Default to 0.
+	DrainDelay time.Duration
 	// Used to tag log messages
 	Tag string
 	// A TagLogger used to log messages
@@ -66,8 +73,15 @@ func (s *Server) Serve(ctx context.Context) error {
 
 	lg.Info("listening at %v", ln.Addr())
 
+	// nil if no limit
+	limiter := s.ConnLimiter
+	if sem.IsNil(limiter) {
+		limiter = nil
+	}
+
 	go func() {
 		<-ctx.Done()
+		readiness.Drain(s.Readiness, s.DrainDelay)
 		ln.Close()
 		lg.Info("received exit signal, exiting")
 	}()
@@ -82,7 +96,7 @@ func (s *Server) Serve(ctx context.Context) error {
 			continue
 		}
 
-		s.handleConn(ctx, conn, lg)
+		s.handleConn(ctx, conn, limiter, lg)
 	}
 
 	return timeouts.WithTimeout(s.ShutdownTimeout, func() error {
@@ -91,13 +105,13 @@ func (s *Server) Serve(ctx context.Context) error {
 	})()
 }
 
-func (s *Server) handleConn(ctx context.Context, conn net.Conn, lg log.TagLogger) {
+func (s *Server) handleConn(ctx context.Context, conn net.Conn, limiter sem.Limiter, lg log.TagLogger) {
 	id := connId()
 	lg = lg.WithTag(id)
 	lg.Info("incoming conn [%v]", conn.RemoteAddr())
 
-	if s.ConnLimiter != nil {
-		err := s.ConnLimiter.Acquire(ctx)
+	if limiter != nil {
+		err := limiter.Acquire(ctx)
 		if err != nil { // ctx.Done channel closed, i.e. exiting
 			_ = conn.Close()
 			return
@@ -109,8 +123,8 @@ func (s *Server) handleConn(ctx context.Context, conn net.Conn, lg log.TagLogger
 		defer func() {
 			conn.Close()
 			s.wg.Done()
-			if s.ConnLimiter != nil {
-				s.ConnLimiter.Release()
+			if limiter != nil {
+				limiter.Release()
 			}
 		}()
 
@@ -78,6 +78,13 @@ func TestServer(t *testing.T) {
 			cltOpt:  clientOpt{timeout: dur},
 			cltOk:   9,
 		},
+		{
+			tag:     "ConnLimiter/typedNil",
+			srv:     &Server{ConnLimiter: nilSem},
+			cltSize: 9,
+			cltOpt:  clientOpt{timeout: dur},
+			cltOk:   9,
+		},
 		// IdleTimeout
 		{
 			tag:     "IdleTimeout/timeout",
@@ -266,6 +273,9 @@ type clientOpt struct {
 	tlsConfig      *tls.Config
 }
 
+// A nil *sem.Sem means no limit.
+var nilSem *sem.Sem
+
 func test(t *testing.T, tc testcase) {
 	light.InitTestLog()
 	as := require.New(t)
@@ -430,3 +440,55 @@ func loadCerts() error {
 
 	return nil
 }
+
+type fakeDrainer struct {
+	mu       sync.Mutex
+	draining bool
+}
+
+func (d *fakeDrainer) MarkDraining() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = true
+}
+
+func (d *fakeDrainer) isDraining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func TestDrain(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	const delay = time.Millisecond * 100
+	addr := randAddr()
+	d := &fakeDrainer{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chSrv := make(chan error, 1)
+	go func() {
+		s := &Server{
+			Addr:        addr,
+			ConnHandler: func(ctx context.Context, conn net.Conn) error { return nil },
+			Readiness:   d,
+			DrainDelay:  delay,
+		}
+		chSrv <- s.Serve(ctx)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	cancel()
+	time.Sleep(delay / 2)
+
+	// marked draining, and still accepting conns during DrainDelay
+	as.True(d.isDraining())
+	conn, err := net.Dial("tcp", addr)
+	as.Nil(err)
+	conn.Close()
+
+	as.Nil(<-chSrv)
+}
@@ -0,0 +1,255 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+/*
+An index of values by key, evicting idle and least recently used values. Shared by sem.KSem and rate.Keyed.
+*/
+package lru
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// An index of values by key, creating values on demand, and evicting values idle, i.e. not got, for longer than TTL,
+// or the least recently used ones if the number of values exceeds SizeHint.
+// Hits are lock-free. The LRU order is approximate, i.e. a value got is moved to the front lazily, when examined for eviction.
+// Eviction is O(1) amortized, since at most maxScan entries are examined per miss.
+type Index[K comparable, V any] struct {
+	cf Conf[V]
+
+	// K -> *entry
+	m sync.Map
+
+	mu sync.Mutex
+	// Approximate LRU ordering. The front is the most recently used.
+	lru       list.List // of *entry
+	size      int
+	evictions int64
+}
+
+type Conf[V any] struct {
+	// Used to create the value of a new key. Required.
+	New func() V
+	// Values not got for TTL are evicted. Default to 0, i.e. no TTL.
+	TTL time.Duration
+	// If the number of values exceeds SizeHint, the least recently used ones are evicted. Default to 0, i.e. no limit.
+	SizeHint int
+	// Return false if the value must not be evicted, e.g. in use. Default to always true.
+	Evictable func(v V) bool
+	// Used to get the current time. Default to time.Now.
+	Now func() time.Time
+}
+
+type entry[K comparable, V any] struct {
+	key K
+	val V
+	el  *list.Element
+	// UnixNano of the last Get
+	used int64
+	// UnixNano of the last re-ordering in the list. Moved to the front lazily if used after it.
+	placed int64
+	// 1 if being evicted or evicted
+	dead int32
+}
+
+func New[K comparable, V any](cf Conf[V]) *Index[K, V] {
+	if cf.Evictable == nil {
+		cf.Evictable = func(V) bool { return true }
+	}
+	if cf.Now == nil {
+		cf.Now = time.Now
+	}
+
+	return &Index[K, V]{cf: cf}
+}
+
+// Get the value of the key, create if not exist.
+func (x *Index[K, V]) Get(key K) V {
+	now := x.cf.Now().UnixNano()
+
+	v, ok := x.m.Load(key)
+	if ok {
+		e := v.(*entry[K, V])
+		atomic.StoreInt64(&e.used, now)
+		// Not being evicted, so the store above is seen by the evictor. See tryEvict.
+		if atomic.LoadInt32(&e.dead) == 0 {
+			return e.val
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	// may have been created, or revived
+	v, ok = x.m.Load(key)
+	if ok {
+		e := v.(*entry[K, V])
+		atomic.StoreInt64(&e.used, now)
+		return e.val
+	}
+
+	x.evictExpired(now, maxScan)
+	if x.cf.SizeHint > 0 && x.size >= x.cf.SizeHint {
+		x.shrink()
+	}
+
+	e := &entry[K, V]{key: key, val: x.cf.New(), used: now, placed: now}
+	e.el = x.lru.PushFront(e)
+	x.m.Store(key, e)
+	x.size++
+
+	return e.val
+}
+
+// Return the value of the key if exist, without affecting its recency.
+func (x *Index[K, V]) Peek(key K) (V, bool) {
+	v, ok := x.m.Load(key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return v.(*entry[K, V]).val, true
+}
+
+// Return the number of live keys, and the number of evicted keys so far.
+func (x *Index[K, V]) Stats() (live int, evictions int64) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.size, x.evictions
+}
+
+// Evict idle values periodically, i.e. every TTL/2, until ctx.Done channel is closed.
+// Without the janitor, idle values are only evicted on Get of new keys.
+// Return immediately if TTL is not set.
+func (x *Index[K, V]) RunJanitor(ctx context.Context) {
+	if x.cf.TTL <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(x.cf.TTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// In batches, so that misses are not blocked for long.
+			for x.EvictBatch() {
+			}
+		}
+	}
+}
+
+// Max number of entries examined per miss
+const maxScan = 8
+
+// Max number of entries examined per janitor batch
+const janitorBatch = 128
+
+// Evict a batch of idle values. Return true if there may be more to evict.
+func (x *Index[K, V]) EvictBatch() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.evictExpired(x.cf.Now().UnixNano(), janitorBatch)
+}
+
+// Evict expired values from the LRU tail, examining at most n entries. Return true if the limit is reached.
+// Must be called with mu held.
+func (x *Index[K, V]) evictExpired(now int64, n int) bool {
+	if x.cf.TTL <= 0 {
+		return false
+	}
+
+	for i := 0; i < n; i++ {
+		el := x.lru.Back()
+		if el == nil {
+			return false
+		}
+
+		e := el.Value.(*entry[K, V])
+		used := atomic.LoadInt64(&e.used)
+		if used > e.placed {
+			// Got since placed. Move it to where it belongs.
+			x.place(e, used)
+			continue
+		}
+
+		if time.Duration(now-used) < x.cf.TTL {
+			return false
+		}
+
+		x.tryEvict(e, used, now)
+	}
+
+	return true
+}
+
+// Evict the least recently used values, until the number of values is below SizeHint, examining at most maxScan entries.
+// Must be called with mu held.
+func (x *Index[K, V]) shrink() {
+	for i := 0; i < maxScan && x.size >= x.cf.SizeHint; i++ {
+		el := x.lru.Back()
+		if el == nil {
+			return
+		}
+
+		e := el.Value.(*entry[K, V])
+		used := atomic.LoadInt64(&e.used)
+		if used > e.placed {
+			x.place(e, used)
+			continue
+		}
+
+		x.tryEvict(e, used, x.cf.Now().UnixNano())
+	}
+}
+
+// Evict the entry, unless it's not evictable, or got concurrently, in which case it's moved to the front.
+// Must be called with mu held.
+func (x *Index[K, V]) tryEvict(e *entry[K, V], used int64, now int64) {
+	if !x.cf.Evictable(e.val) {
+		x.place(e, now)
+		return
+	}
+
+	// Mark dead, then check whether got meanwhile. Get stores used before loading dead,
+	// so either Get sees dead and falls back to the locked path, or the store is seen here.
+	atomic.StoreInt32(&e.dead, 1)
+	if u := atomic.LoadInt64(&e.used); u != used {
+		atomic.StoreInt32(&e.dead, 0)
+		x.place(e, u)
+		return
+	}
+
+	x.lru.Remove(e.el)
+	x.m.Delete(e.key)
+	x.size--
+	x.evictions++
+}
+
+// Move the entry to the front, as if got at the time.
+// Must be called with mu held.
+func (x *Index[K, V]) place(e *entry[K, V], at int64) {
+	// Never lower used, which may be stored by Get concurrently.
+	for {
+		used := atomic.LoadInt64(&e.used)
+		if used >= at || atomic.CompareAndSwapInt64(&e.used, used, at) {
+			break
+		}
+	}
+
+	e.placed = at
+	x.lru.MoveToFront(e.el)
+}
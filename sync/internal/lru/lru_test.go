@@ -0,0 +1,220 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package lru
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newCounter() func() *int {
+	n := 0
+	return func() *int {
+		n++
+		v := n
+		return &v
+	}
+}
+
+func TestGet(t *testing.T) {
+	as := require.New(t)
+
+	x := New[string](Conf[*int]{New: newCounter()})
+	a := x.Get("a")
+	as.Equal(1, *a)
+	as.Same(a, x.Get("a"))
+	as.Equal(2, *x.Get("b"))
+
+	v, ok := x.Peek("a")
+	as.True(ok)
+	as.Same(a, v)
+	_, ok = x.Peek("c")
+	as.False(ok)
+
+	live, evictions := x.Stats()
+	as.Equal(2, live)
+	as.Equal(int64(0), evictions)
+}
+
+func TestSizeHint(t *testing.T) {
+	as := require.New(t)
+
+	c := &fakeClock{t: time.Now()}
+	// by value, i.e. the order of creation
+	busy := map[int]bool{}
+	x := New[string](Conf[*int]{
+		New:      newCounter(),
+		SizeHint: 2,
+		Evictable: func(v *int) bool {
+			return !busy[*v]
+		},
+		Now: c.now,
+	})
+
+	x.Get("a")
+	c.add(time.Millisecond)
+	x.Get("b")
+	c.add(time.Millisecond)
+	// a is more recently used than b, though re-ordered lazily.
+	x.Get("a")
+	c.add(time.Millisecond)
+
+	x.Get("c")
+	_, ok := x.Peek("b")
+	as.False(ok)
+	_, ok = x.Peek("a")
+	as.True(ok)
+
+	// Busy ones are not evicted.
+	// a and c
+	busy[1], busy[3] = true, true
+	c.add(time.Millisecond)
+	x.Get("d")
+	live, evictions := x.Stats()
+	as.Equal(3, live)
+	as.Equal(int64(1), evictions)
+}
+
+func TestTTL(t *testing.T) {
+	as := require.New(t)
+
+	const ttl = time.Minute
+	c := &fakeClock{t: time.Now()}
+	x := New[int](Conf[*int]{New: newCounter(), TTL: ttl, Now: c.now})
+
+	x.Get(1)
+	x.Get(2)
+	c.add(ttl / 2)
+	// keep 1 alive
+	x.Get(1)
+	c.add(ttl / 2)
+
+	x.Get(3)
+	_, ok := x.Peek(2)
+	as.False(ok)
+	_, ok = x.Peek(1)
+	as.True(ok)
+
+	c.add(ttl)
+	as.False(x.EvictBatch())
+	live, evictions := x.Stats()
+	as.Equal(0, live)
+	as.Equal(int64(3), evictions)
+}
+
+func TestBoundedScan(t *testing.T) {
+	as := require.New(t)
+
+	const ttl = time.Minute
+	c := &fakeClock{t: time.Now()}
+	x := New[int](Conf[*int]{New: newCounter(), TTL: ttl, Now: c.now})
+
+	const n = maxScan * 3
+	for i := 0; i < n; i++ {
+		x.Get(i)
+	}
+	c.add(ttl)
+
+	// At most maxScan evicted per miss
+	x.Get(n)
+	live, evictions := x.Stats()
+	as.Equal(n-maxScan+1, live)
+	as.Equal(int64(maxScan), evictions)
+
+	// the rest by the janitor, stopping at the fresh one
+	as.False(x.EvictBatch())
+	live, evictions = x.Stats()
+	as.Equal(1, live)
+	as.Equal(int64(n), evictions)
+}
+
+func TestJanitor(t *testing.T) {
+	as := require.New(t)
+
+	const ttl = time.Millisecond * 20
+	x := New[int](Conf[*int]{New: newCounter(), TTL: ttl})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		x.RunJanitor(ctx)
+	}()
+
+	const n = janitorBatch*2 + 1
+	for i := 0; i < n; i++ {
+		x.Get(i)
+	}
+	as.Eventually(func() bool {
+		live, _ := x.Stats()
+		return live == 0
+	}, time.Second, ttl)
+
+	cancel()
+	<-done
+
+	// no TTL, return immediately
+	New[int](Conf[*int]{New: newCounter()}).RunJanitor(context.Background())
+}
+
+// A value got concurrently with its eviction is either kept, or re-created, but never lost while in the index.
+func TestConcurrent(t *testing.T) {
+	as := require.New(t)
+
+	x := New[int](Conf[*int]{New: newCounter(), SizeHint: 4, TTL: time.Millisecond})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				k := (g + i) % 16
+				v := x.Get(k)
+				if got, ok := x.Peek(k); ok && got != v {
+					// re-created after eviction
+					continue
+				}
+				x.EvictBatch()
+			}
+		}()
+	}
+	wg.Wait()
+
+	live, _ := x.Stats()
+	n := 0
+	for k := 0; k < 16; k++ {
+		if _, ok := x.Peek(k); ok {
+			n++
+		}
+	}
+	as.Equal(live, n)
+}
@@ -0,0 +1,191 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+/*
+Context-aware locks, i.e. acquisition may be given up on ctx done or timeout.
+*/
+package lock
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// A context-aware reader/writer mutual exclusion lock.
+// The lock can be held by an arbitrary number of readers or a single writer.
+// Waiters are served in FIFO order, so that neither readers nor writers are starved.
+// The zero value is an unlocked mutex.
+type RWMutex struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	waiters list.List // of *waiter
+}
+
+type waiter struct {
+	write bool
+	ready chan struct{}
+}
+
+// Lock for writing.
+// If not available, block until available or ctx.Done channel is closed.
+func (m *RWMutex) Lock(ctx context.Context) error {
+	return m.acquire(ctx, true)
+}
+
+// Same as Lock, but give up after timeout.
+func (m *RWMutex) LockTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return m.Lock(ctx)
+}
+
+// Try to lock for writing.
+// Return true if available, false otherwise.
+func (m *RWMutex) TryLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canWrite() {
+		return false
+	}
+
+	m.writer = true
+	return true
+}
+
+// Unlock for writing. Panic if not locked for writing.
+func (m *RWMutex) Unlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.writer {
+		panic("lock: Unlock of unlocked RWMutex")
+	}
+
+	m.writer = false
+	m.notify()
+}
+
+// Lock for reading.
+// If not available, block until available or ctx.Done channel is closed.
+func (m *RWMutex) RLock(ctx context.Context) error {
+	return m.acquire(ctx, false)
+}
+
+// Same as RLock, but give up after timeout.
+func (m *RWMutex) RLockTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return m.RLock(ctx)
+}
+
+// Try to lock for reading.
+// Return true if available, false otherwise.
+func (m *RWMutex) TryRLock() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.canRead() {
+		return false
+	}
+
+	m.readers++
+	return true
+}
+
+// Unlock for reading. Panic if not locked for reading.
+func (m *RWMutex) RUnlock() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.readers == 0 {
+		panic("lock: RUnlock of unlocked RWMutex")
+	}
+
+	m.readers--
+	m.notify()
+}
+
+func (m *RWMutex) acquire(ctx context.Context, write bool) error {
+	m.mu.Lock()
+	if write && m.canWrite() {
+		m.writer = true
+		m.mu.Unlock()
+		return nil
+	}
+	if !write && m.canRead() {
+		m.readers++
+		m.mu.Unlock()
+		return nil
+	}
+
+	wt := &waiter{write: write, ready: make(chan struct{})}
+	elem := m.waiters.PushBack(wt)
+	m.mu.Unlock()
+
+	select {
+	case <-wt.ready:
+		return nil
+
+	case <-ctx.Done():
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		select {
+		case <-wt.ready:
+			// Granted right after ctx is done. Give it back.
+			if write {
+				m.writer = false
+			} else {
+				m.readers--
+			}
+		default:
+			m.waiters.Remove(elem)
+		}
+
+		// Waiters behind may be servable now.
+		m.notify()
+		return ctx.Err()
+	}
+}
+
+// Must be called with mu held.
+func (m *RWMutex) canWrite() bool {
+	return !m.writer && m.readers == 0 && m.waiters.Len() == 0
+}
+
+// A reader waits if a writer holds the lock or any waits, so that writers are not starved.
+// Must be called with mu held.
+func (m *RWMutex) canRead() bool {
+	return !m.writer && m.waiters.Len() == 0
+}
+
+// Grant the lock to waiters in FIFO order while available, i.e. a writer, or consecutive readers.
+// Must be called with mu held.
+func (m *RWMutex) notify() {
+	for m.waiters.Len() > 0 && !m.writer {
+		elem := m.waiters.Front()
+		wt := elem.Value.(*waiter)
+		if wt.write {
+			if m.readers > 0 {
+				return
+			}
+			m.writer = true
+		} else {
+			m.readers++
+		}
+
+		m.waiters.Remove(elem)
+		close(wt.ready)
+	}
+}
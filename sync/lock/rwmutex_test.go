@@ -0,0 +1,109 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const timeout = time.Millisecond * 100
+
+func TestRWMutex(t *testing.T) {
+	as := require.New(t)
+
+	var m RWMutex
+	as.Nil(m.RLock(context.Background()))
+	as.True(m.TryRLock())
+	as.False(m.TryLock())
+	as.ErrorIs(m.LockTimeout(timeout), context.DeadlineExceeded)
+
+	m.RUnlock()
+	m.RUnlock()
+	as.Nil(m.Lock(context.Background()))
+	as.False(m.TryRLock())
+	as.False(m.TryLock())
+	as.ErrorIs(m.RLockTimeout(timeout), context.DeadlineExceeded)
+
+	m.Unlock()
+	as.True(m.TryLock())
+	m.Unlock()
+
+	as.Panics(m.Unlock)
+	as.Panics(m.RUnlock)
+}
+
+func TestRWMutexFIFO(t *testing.T) {
+	as := require.New(t)
+
+	var m RWMutex
+	as.True(m.TryRLock())
+
+	// A waiting writer blocks new readers.
+	wlocked := make(chan struct{})
+	go func() {
+		as.Nil(m.Lock(context.Background()))
+		close(wlocked)
+	}()
+	as.Eventually(func() bool {
+		return !m.TryRLock()
+	}, time.Second, time.Millisecond)
+
+	rlocked := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			as.Nil(m.RLock(context.Background()))
+			rlocked <- struct{}{}
+		}()
+	}
+	time.Sleep(time.Millisecond * 10)
+
+	m.RUnlock()
+	<-wlocked
+	as.Empty(rlocked)
+
+	// Both readers are granted together.
+	m.Unlock()
+	<-rlocked
+	<-rlocked
+	m.RUnlock()
+	m.RUnlock()
+	as.True(m.TryLock())
+}
+
+func TestRWMutexCancel(t *testing.T) {
+	as := require.New(t)
+
+	var m RWMutex
+	as.True(m.TryRLock())
+
+	// A writer gives up, and readers behind it are granted.
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error)
+	go func() {
+		errCh <- m.Lock(ctx)
+	}()
+	as.Eventually(func() bool {
+		return !m.TryRLock()
+	}, time.Second, time.Millisecond)
+
+	rlocked := make(chan struct{})
+	go func() {
+		as.Nil(m.RLock(context.Background()))
+		close(rlocked)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	cancel()
+	as.ErrorIs(<-errCh, context.Canceled)
+	<-rlocked
+}
@@ -0,0 +1,197 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// Token bucket. The bucket holds at most burst tokens, and is refilled at rate tokens per second.
+// Each event takes a token.
+type Bucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	now func() time.Time
+}
+
+// Create a token bucket, which is full initially.
+// The rate is the number of tokens refilled per second. The burst is the capacity of the bucket.
+func NewBucket(rate float64, burst int) *Bucket {
+	if rate < 0 {
+		rate = 0
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	b := &Bucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		now:    time.Now,
+	}
+	b.last = b.now()
+	return b
+}
+
+// Return true if a token is available now, and take it.
+func (b *Bucket) Allow() bool {
+	return b.AllowN(1)
+}
+
+// Return true if n tokens are available now, and take them.
+func (b *Bucket) AllowN(n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < float64(n) {
+		return false
+	}
+
+	b.tokens -= float64(n)
+	return true
+}
+
+// Return true if a token is available now, and take it.
+// Otherwise, return false and how long to wait before a token is available.
+func (b *Bucket) Try() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, b.wait(1 - b.tokens)
+}
+
+// Take a token now, whether available or not, and return a Reservation telling how long to wait before the event may happen.
+// The Reservation is not OK if the event may never happen, i.e. the rate is 0 and the bucket is empty.
+func (b *Bucket) Reserve() *Reservation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	if b.tokens < 1 && b.rate == 0 {
+		return &Reservation{}
+	}
+
+	b.tokens--
+	r := &Reservation{b: b, ok: true}
+	if b.tokens < 0 {
+		r.delay = b.wait(-b.tokens)
+	}
+	return r
+}
+
+var ErrNever = errors.New("rate limit would never allow the event")
+
+// Wait until a token is available, and take it.
+// Return an error if ctx.Done channel is closed first, or it can be predicted that ctx deadline would be exceeded first.
+func (b *Bucket) Wait(ctx context.Context) error {
+	r := b.Reserve()
+	if !r.OK() {
+		return ErrNever
+	}
+	if r.delay == 0 {
+		return nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < r.delay {
+		r.Cancel()
+		return context.DeadlineExceeded
+	}
+
+	timer := time.NewTimer(r.delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// Return the number of tokens available now.
+func (b *Bucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill()
+	return b.tokens
+}
+
+// Must be called with mu held.
+func (b *Bucket) refill() {
+	now := b.now()
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+
+	b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	b.last = now
+}
+
+// How long it takes to refill n tokens
+func (b *Bucket) wait(n float64) time.Duration {
+	if b.rate == 0 {
+		return time.Duration(math.MaxInt64)
+	}
+
+	return time.Duration(math.Ceil(n / b.rate * float64(time.Second)))
+}
+
+// A token taken by Bucket.Reserve
+type Reservation struct {
+	b     *Bucket
+	ok    bool
+	delay time.Duration
+
+	cancelOnce sync.Once
+}
+
+// Return false if the event may never happen.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// How long to wait before the event may happen
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Give the token back, e.g. if the event will not happen. Idempotent.
+func (r *Reservation) Cancel() {
+	if !r.ok {
+		return
+	}
+
+	r.cancelOnce.Do(func() {
+		r.b.mu.Lock()
+		defer r.b.mu.Unlock()
+
+		r.b.refill()
+		r.b.tokens = math.Min(r.b.burst, r.b.tokens+1)
+	})
+}
@@ -0,0 +1,124 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Limiter = (*Bucket)(nil)
+var _ Limiter = (*Window)(nil)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func (c *fakeClock) add(d time.Duration) {
+	c.t = c.t.Add(d)
+}
+
+func newFakeBucket(rate float64, burst int) (*Bucket, *fakeClock) {
+	c := &fakeClock{t: time.Now()}
+	b := NewBucket(rate, burst)
+	b.now = c.now
+	b.last = c.t
+	return b, c
+}
+
+func TestBucketAllow(t *testing.T) {
+	as := require.New(t)
+
+	b, c := newFakeBucket(10, 3)
+	for i := 0; i < 3; i++ {
+		as.True(b.Allow())
+	}
+	as.False(b.Allow())
+
+	ok, retryAfter := b.Try()
+	as.False(ok)
+	as.Equal(time.Millisecond*100, retryAfter)
+
+	c.add(time.Millisecond * 100)
+	as.True(b.Allow())
+	as.False(b.Allow())
+
+	// never more than burst
+	c.add(time.Hour)
+	as.Equal(float64(3), b.Tokens())
+	as.False(b.AllowN(4))
+	as.True(b.AllowN(3))
+}
+
+func TestBucketReserve(t *testing.T) {
+	as := require.New(t)
+
+	b, c := newFakeBucket(10, 1)
+	r := b.Reserve()
+	as.True(r.OK())
+	as.Zero(r.Delay())
+
+	r = b.Reserve()
+	as.True(r.OK())
+	as.Equal(time.Millisecond*100, r.Delay())
+	r = b.Reserve()
+	as.Equal(time.Millisecond*200, r.Delay())
+
+	// idempotent
+	r.Cancel()
+	r.Cancel()
+	c.add(time.Millisecond * 200)
+	as.Equal(float64(1), b.Tokens())
+
+	// never
+	b, _ = newFakeBucket(0, 1)
+	as.True(b.Reserve().OK())
+	as.False(b.Reserve().OK())
+}
+
+func TestBucketWait(t *testing.T) {
+	as := require.New(t)
+
+	b := NewBucket(100, 1)
+	as.Nil(b.Wait(context.Background()))
+
+	start := time.Now()
+	as.Nil(b.Wait(context.Background()))
+	as.GreaterOrEqual(time.Since(start), time.Millisecond*5)
+
+	// would exceed the deadline
+	b = NewBucket(1, 1)
+	as.True(b.Allow())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	as.ErrorIs(b.Wait(ctx), context.DeadlineExceeded)
+	// token given back
+	as.Less(b.Tokens(), float64(0.1))
+	as.Greater(b.Tokens(), float64(-0.1))
+
+	// canceled
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		cancel()
+	}()
+	as.ErrorIs(b.Wait(ctx), context.Canceled)
+	as.Greater(b.Tokens(), float64(-0.1))
+
+	b = NewBucket(0, 1)
+	as.True(b.Allow())
+	as.ErrorIs(b.Wait(context.Background()), ErrNever)
+}
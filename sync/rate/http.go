@@ -0,0 +1,61 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Return a handler which rejects requests exceeding the rate limit with 429 and a Retry-After header.
+func LimitHandler(l Limiter, handler http.Handler) http.Handler {
+	if l == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := l.Try()
+		if !ok {
+			tooMany(rw, retryAfter)
+			return
+		}
+
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+// Return a handler which rate limits requests per key, e.g. per client IP, and rejects requests exceeding the rate limit with 429 and a Retry-After header.
+func KeyedLimitHandler[K comparable](ks *Keyed[K], keyFn func(r *http.Request) K, handler http.Handler) http.Handler {
+	if ks == nil {
+		return handler
+	}
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := ks.Try(keyFn(r))
+		if !ok {
+			tooMany(rw, retryAfter)
+			return
+		}
+
+		handler.ServeHTTP(rw, r)
+	})
+}
+
+func tooMany(rw http.ResponseWriter, retryAfter time.Duration) {
+	// in seconds, rounded up
+	secs := int64(math.Ceil(retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+
+	rw.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	http.Error(rw, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
@@ -0,0 +1,49 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitHandler(t *testing.T) {
+	as := require.New(t)
+
+	ok := http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {})
+	do := func(h http.Handler, ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = ip + ":1234"
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+		return rw
+	}
+
+	h := LimitHandler(NewWindow(1, time.Second*5), ok)
+	as.Equal(http.StatusOK, do(h, "1.1.1.1").Code)
+	rw := do(h, "1.1.1.1")
+	as.Equal(http.StatusTooManyRequests, rw.Code)
+	as.Equal("5", rw.Header().Get("Retry-After"))
+
+	ks := NewKeyed[string](func() Limiter {
+		return NewBucket(0.5, 1)
+	}, 0)
+	h = KeyedLimitHandler(ks, func(r *http.Request) string {
+		return r.RemoteAddr[:len(r.RemoteAddr)-len(":1234")]
+	}, ok)
+	as.Equal(http.StatusOK, do(h, "1.1.1.1").Code)
+	as.Equal(http.StatusOK, do(h, "2.2.2.2").Code)
+	rw = do(h, "1.1.1.1")
+	as.Equal(http.StatusTooManyRequests, rw.Code)
+	as.Equal("2", rw.Header().Get("Retry-After"))
+}
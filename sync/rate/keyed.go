@@ -0,0 +1,76 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"context"
+	"time"
+
+	"github.com/burningxflame/gx/sync/internal/lru"
+)
+
+// Keyed rate limiters. Commonly used for limiting rate per key, e.g. per client.
+// A limiter idle, i.e. not used, for longer than idleTTL is evicted.
+type Keyed[K comparable] struct {
+	idx *lru.Index[K, Limiter]
+}
+
+// Stats of keyed rate limiters
+type KeyedStats struct {
+	// The number of live keys
+	Live int
+	// The number of evicted keys so far
+	Evictions int64
+}
+
+// Create keyed rate limiters.
+// The newFn is used to create the limiter of a key, e.g. func() rate.Limiter { return rate.NewBucket(10, 20) }.
+// A limiter idle for longer than idleTTL is evicted, so idleTTL should be longer than the time to refill a limiter. Default to 10m.
+func NewKeyed[K comparable](newFn func() Limiter, idleTTL time.Duration) *Keyed[K] {
+	return newKeyed[K](newFn, idleTTL, time.Now)
+}
+
+func newKeyed[K comparable](newFn func() Limiter, idleTTL time.Duration, now func() time.Time) *Keyed[K] {
+	if idleTTL <= 0 {
+		idleTTL = time.Minute * 10
+	}
+
+	return &Keyed[K]{
+		idx: lru.New[K](lru.Conf[Limiter]{
+			New: newFn,
+			TTL: idleTTL,
+			Now: now,
+		}),
+	}
+}
+
+// Get the limiter of the key, create if not exist. Lock-free if exist.
+func (k *Keyed[K]) Get(key K) Limiter {
+	return k.idx.Get(key)
+}
+
+// Same as Get(key).Try()
+func (k *Keyed[K]) Try(key K) (bool, time.Duration) {
+	return k.Get(key).Try()
+}
+
+// Return stats of the keyed rate limiters.
+func (k *Keyed[K]) Stats() KeyedStats {
+	live, evictions := k.idx.Stats()
+	return KeyedStats{
+		Live:      live,
+		Evictions: evictions,
+	}
+}
+
+// Evict idle limiters periodically, i.e. every idleTTL/2, until ctx.Done channel is closed.
+// Without the janitor, idle limiters are only evicted on Get of new keys.
+func (k *Keyed[K]) RunJanitor(ctx context.Context) {
+	k.idx.RunJanitor(ctx)
+}
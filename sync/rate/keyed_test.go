@@ -0,0 +1,80 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyed(t *testing.T) {
+	as := require.New(t)
+
+	c := &fakeClock{t: time.Now()}
+	ks := newKeyed[string](func() Limiter {
+		w := NewWindow(1, time.Hour)
+		w.now = c.now
+		return w
+	}, time.Minute, c.now)
+
+	ok, _ := ks.Try("a")
+	as.True(ok)
+	ok, _ = ks.Try("a")
+	as.False(ok)
+	// independent per key
+	ok, _ = ks.Try("b")
+	as.True(ok)
+	as.Equal(KeyedStats{Live: 2}, ks.Stats())
+
+	// keep a alive
+	c.add(time.Second * 40)
+	ks.Get("a")
+	c.add(time.Second * 40)
+
+	// b idle for longer than idleTTL, evicted on Get of a new key
+	ks.Get("c")
+	as.Equal(KeyedStats{Live: 2, Evictions: 1}, ks.Stats())
+
+	ok, _ = ks.Try("a")
+	as.False(ok)
+	ok, _ = ks.Try("b")
+	as.True(ok)
+}
+
+func TestKeyedJanitor(t *testing.T) {
+	as := require.New(t)
+
+	const ttl = time.Millisecond * 20
+	ks := NewKeyed[string](func() Limiter {
+		return NewBucket(1, 1)
+	}, ttl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ks.RunJanitor(ctx)
+	}()
+
+	const n = 300
+	for i := 0; i < n; i++ {
+		ks.Get(strconv.Itoa(i))
+	}
+	as.Eventually(func() bool {
+		return ks.Stats().Live == 0
+	}, time.Second, ttl)
+	as.Equal(KeyedStats{Evictions: n}, ks.Stats())
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,21 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+/*
+Rate limiters, i.e. token bucket and sliding window log, a keyed variant, e.g. per client, and an HTTP middleware.
+*/
+package rate
+
+import "time"
+
+// Limiter limits the rate of events. Implemented by Bucket and Window.
+type Limiter interface {
+	// Return true if an event may happen now, and account it.
+	// Otherwise, return false and how long to wait before retrying.
+	Try() (ok bool, retryAfter time.Duration)
+}
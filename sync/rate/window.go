@@ -0,0 +1,71 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"sync"
+	"time"
+)
+
+// Sliding window log. At most limit events may happen in any window, e.g. 100 events in any minute.
+// Unlike a token bucket, bursts are bounded in every window, at the cost of memory proportional to limit.
+type Window struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// ring buffer of the times of events in the window
+	log   []time.Time
+	head  int
+	count int
+
+	now func() time.Time
+}
+
+// Create a sliding window log, which allows at most limit events in any window.
+func NewWindow(limit int, window time.Duration) *Window {
+	if limit < 1 {
+		limit = 1
+	}
+	if window <= 0 {
+		window = time.Second
+	}
+
+	return &Window{
+		window: window,
+		log:    make([]time.Time, limit),
+		now:    time.Now,
+	}
+}
+
+// Return true if an event may happen now, and account it.
+func (w *Window) Allow() bool {
+	ok, _ := w.Try()
+	return ok
+}
+
+// Return true if an event may happen now, and account it.
+// Otherwise, return false and how long to wait before the oldest event leaves the window.
+func (w *Window) Try() (bool, time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.now()
+	for w.count > 0 && now.Sub(w.log[w.head]) >= w.window {
+		w.head = (w.head + 1) % len(w.log)
+		w.count--
+	}
+
+	if w.count == len(w.log) {
+		return false, w.log[w.head].Add(w.window).Sub(now)
+	}
+
+	w.log[(w.head+w.count)%len(w.log)] = now
+	w.count++
+	return true, 0
+}
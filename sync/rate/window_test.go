@@ -0,0 +1,51 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package rate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	as := require.New(t)
+
+	c := &fakeClock{t: time.Now()}
+	w := NewWindow(3, time.Second)
+	w.now = c.now
+
+	as.True(w.Allow())
+	c.add(time.Millisecond * 300)
+	as.True(w.Allow())
+	as.True(w.Allow())
+
+	ok, retryAfter := w.Try()
+	as.False(ok)
+	as.Equal(time.Millisecond*700, retryAfter)
+
+	// the first event leaves the window
+	c.add(time.Millisecond * 700)
+	as.True(w.Allow())
+	as.False(w.Allow())
+
+	// the 2nd and 3rd leave
+	c.add(time.Millisecond * 300)
+	as.True(w.Allow())
+	as.True(w.Allow())
+	as.False(w.Allow())
+
+	// all leave
+	c.add(time.Second * 10)
+	for i := 0; i < 3; i++ {
+		as.True(w.Allow())
+	}
+	as.False(w.Allow())
+}
@@ -0,0 +1,235 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type AdaptiveConf struct {
+	// Min limit. Default to 1.
+	Min int
+	// Max limit. Default to 1000.
+	Max int
+	// Initial limit. Default to Min.
+	Initial int
+	// The limit is adjusted once per Window. Default to 1s.
+	Window time.Duration
+	// If the average latency in a Window exceeds Tolerance times the min latency, the limit is decreased.
+	// Default to 2.
+	Tolerance float64
+	// Multiplier of the limit on decrease, in (0, 1). Default to 0.9.
+	Backoff float64
+}
+
+// Adaptive is a concurrency limiter whose limit is adjusted with AIMD (additive increase, multiplicative decrease) based on observed latency,
+// i.e. the time between Acquire and Release.
+// At the end of each Window, if the average latency exceeds Tolerance times the min latency, the limit is multiplied by Backoff.
+// Otherwise, if the limit was reached in the Window, the limit is increased by 1.
+// Waiters are served in FIFO order.
+type Adaptive struct {
+	cf AdaptiveConf
+
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	waiters  list.List // of chan struct{}
+
+	// stats of the current window
+	winStart time.Time
+	// last time inFlight changed
+	last time.Time
+	// integral of inFlight over time, i.e. the total latency of requests in the window
+	busy      time.Duration
+	released  int
+	saturated bool
+	// min average latency ever seen, drifting up slowly so that a new baseline is adopted
+	minLat time.Duration
+
+	now func() time.Time
+}
+
+// Create an adaptive concurrency limiter.
+func NewAdaptive(cf AdaptiveConf) *Adaptive {
+	if cf.Min < 1 {
+		cf.Min = 1
+	}
+	if cf.Max < 1 {
+		cf.Max = 1000
+	}
+	if cf.Max < cf.Min {
+		cf.Max = cf.Min
+	}
+	if cf.Initial < cf.Min {
+		cf.Initial = cf.Min
+	}
+	if cf.Initial > cf.Max {
+		cf.Initial = cf.Max
+	}
+	if cf.Window <= 0 {
+		cf.Window = time.Second
+	}
+	if cf.Tolerance <= 1 {
+		cf.Tolerance = 2
+	}
+	if cf.Backoff <= 0 || cf.Backoff >= 1 {
+		cf.Backoff = 0.9
+	}
+
+	a := &Adaptive{
+		cf:    cf,
+		limit: cf.Initial,
+		now:   time.Now,
+	}
+	a.winStart = a.now()
+	a.last = a.winStart
+	return a
+}
+
+// Acquire a permit.
+// If none is available, block until one is available or ctx.Done channel is closed.
+func (a *Adaptive) Acquire(ctx context.Context) error {
+	a.mu.Lock()
+	if a.waiters.Len() == 0 && a.inFlight < a.limit {
+		a.acquire()
+		a.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := a.waiters.PushBack(ready)
+	a.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+
+	case <-ctx.Done():
+		a.mu.Lock()
+		defer a.mu.Unlock()
+
+		select {
+		case <-ready:
+			// Granted right after ctx is done. Give it back.
+			a.release()
+		default:
+			a.waiters.Remove(elem)
+			// Waiters behind may be servable now.
+			a.notify()
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Try to acquire a permit.
+// Return true if available, false otherwise.
+func (a *Adaptive) TryAcquire() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.waiters.Len() > 0 || a.inFlight >= a.limit {
+		return false
+	}
+
+	a.acquire()
+	return true
+}
+
+// Release a permit. A no-op if no permit is taken.
+func (a *Adaptive) Release() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.inFlight == 0 {
+		return
+	}
+
+	a.release()
+}
+
+// Return the current limit.
+func (a *Adaptive) Limit() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.limit
+}
+
+// Return the number of permits taken.
+func (a *Adaptive) InFlight() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.inFlight
+}
+
+// Must be called with mu held.
+func (a *Adaptive) acquire() {
+	a.tick()
+	a.inFlight++
+	if a.inFlight >= a.limit {
+		a.saturated = true
+	}
+}
+
+// Must be called with mu held.
+func (a *Adaptive) release() {
+	a.tick()
+	a.inFlight--
+	a.released++
+	a.notify()
+}
+
+// Account the time since the last change of inFlight, and adjust the limit at the end of a window.
+// Must be called with mu held.
+func (a *Adaptive) tick() {
+	now := a.now()
+	a.busy += time.Duration(a.inFlight) * now.Sub(a.last)
+	a.last = now
+
+	if now.Sub(a.winStart) < a.cf.Window || a.released == 0 {
+		return
+	}
+
+	lat := a.busy / time.Duration(a.released)
+	if a.minLat == 0 || lat < a.minLat {
+		a.minLat = lat
+	} else {
+		// drift up by 1% per window
+		a.minLat += a.minLat / 100
+	}
+
+	switch {
+	case float64(lat) > a.cf.Tolerance*float64(a.minLat):
+		a.limit = int(float64(a.limit) * a.cf.Backoff)
+		if a.limit < a.cf.Min {
+			a.limit = a.cf.Min
+		}
+	case a.saturated && a.limit < a.cf.Max:
+		a.limit++
+	}
+
+	a.winStart, a.busy, a.released = now, 0, 0
+	a.saturated = a.inFlight >= a.limit
+}
+
+// Grant permits to waiters in FIFO order while available.
+// Must be called with mu held.
+func (a *Adaptive) notify() {
+	for a.waiters.Len() > 0 && a.inFlight < a.limit {
+		elem := a.waiters.Front()
+		a.waiters.Remove(elem)
+		a.acquire()
+		close(elem.Value.(chan struct{}))
+	}
+}
@@ -0,0 +1,110 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Limiter = (*Sem)(nil)
+var _ Limiter = (*Adaptive)(nil)
+
+func TestAdaptiveAcquire(t *testing.T) {
+	as := require.New(t)
+
+	a := NewAdaptive(AdaptiveConf{Min: ca, Max: ca})
+	for i := 0; i < ca; i++ {
+		as.True(a.TryAcquire())
+	}
+	as.False(a.TryAcquire())
+	as.Equal(ca, a.InFlight())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	as.Error(a.Acquire(ctx))
+
+	// FIFO waiters
+	order := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		i := i
+		go func() {
+			as.Nil(a.Acquire(context.Background()))
+			order <- i
+		}()
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	a.Release()
+	as.Equal(0, <-order)
+	a.Release()
+	as.Equal(1, <-order)
+	as.Equal(ca, a.InFlight())
+
+	for i := 0; i < ca; i++ {
+		a.Release()
+	}
+	// no-op if none taken
+	a.Release()
+	as.Equal(0, a.InFlight())
+}
+
+// Drive the limiter with a fake clock.
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func TestAdaptiveAIMD(t *testing.T) {
+	as := require.New(t)
+
+	const window = time.Second
+	a := NewAdaptive(AdaptiveConf{Min: 2, Max: 100, Initial: 10, Window: window})
+	c := &fakeClock{t: time.Now()}
+	a.now = c.now
+	a.winStart, a.last = c.t, c.t
+
+	// Run a window of requests at full concurrency, each taking lat.
+	round := func(lat time.Duration) {
+		n := a.Limit()
+		for elapsed := time.Duration(0); elapsed < window; elapsed += lat {
+			for i := 0; i < n; i++ {
+				as.True(a.TryAcquire())
+			}
+			c.t = c.t.Add(lat)
+			for i := 0; i < n; i++ {
+				a.Release()
+			}
+		}
+	}
+
+	// low latency, saturated: additive increase
+	for i := 0; i < 5; i++ {
+		round(time.Millisecond * 10)
+	}
+	n := a.Limit()
+	as.Greater(n, 10)
+	as.LessOrEqual(n, 15)
+
+	// high latency: multiplicative decrease
+	round(time.Millisecond * 50)
+	as.Less(a.Limit(), n)
+
+	// never below Min
+	for i := 0; i < 50; i++ {
+		round(time.Millisecond * 100)
+	}
+	as.Equal(2, a.Limit())
+}
@@ -10,6 +10,8 @@ package sem
 
 import (
 	"context"
+	"strconv"
+	"sync/atomic"
 	"testing"
 )
 
@@ -23,3 +25,25 @@ func BenchmarkAcquireRelease(b *testing.B) {
 		s.Release()
 	}
 }
+
+// Get of existing keys in parallel, i.e. the hot path
+func BenchmarkKSemGetParallel(b *testing.B) {
+	const nKeys = 1024
+	ks := NewKSem[string](1, nKeys*2)
+
+	keys := make([]string, nKeys)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+		ks.Get(keys[i])
+	}
+
+	var seed int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&seed, 1)
+		for pb.Next() {
+			ks.Get(keys[i%nKeys])
+			i++
+		}
+	})
+}
@@ -0,0 +1,211 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/burningxflame/gx/runtime/gid"
+)
+
+type SemConf struct {
+	// Capacity of the semaphore. Default to 1.
+	Cap int
+	// If true, releasing a permit when none is taken is reported via OnMisuse, e.g. a double release.
+	Strict bool
+	// Used to report misuses in strict mode. Default to panic.
+	OnMisuse func(err error)
+	// If true, track holders of permits, i.e. goroutines who acquired permits, for diagnosing leaked permits. See Holders.
+	// Slower, so mainly for debugging.
+	Track bool
+}
+
+var ErrOverRelease = errors.New("release a permit while none is taken")
+
+// Create a semaphore with debugging features.
+func NewConf(cf SemConf) *Sem {
+	s := New(cf.Cap)
+	if !cf.Strict && !cf.Track {
+		return s
+	}
+
+	if cf.OnMisuse == nil {
+		cf.OnMisuse = func(err error) {
+			panic(err)
+		}
+	}
+
+	s.dbg = &debug{
+		strict:   cf.Strict,
+		onMisuse: cf.OnMisuse,
+		trackOn:  cf.Track,
+		holders:  make(map[uint]*Holder),
+	}
+	return s
+}
+
+// Acquire a permit, same as Acquire, and return a func to release it.
+// The func is idempotent, i.e. only the first call releases the permit, so that it's safe to both defer and call it early.
+func (s *Sem) AcquireFunc(ctx context.Context) (release func(), err error) {
+	err = s.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.releaseFunc(), nil
+}
+
+// Try to acquire a permit, same as TryAcquire, and return a func to release it.
+// The func is idempotent, i.e. only the first call releases the permit.
+func (s *Sem) TryAcquireFunc() (release func(), ok bool) {
+	if !s.TryAcquire() {
+		return nil, false
+	}
+
+	return s.releaseFunc(), true
+}
+
+func (s *Sem) releaseFunc() func() {
+	var holder uint
+	if s.dbg != nil {
+		holder = gid.Gid()
+	}
+
+	var released int32
+	return func() {
+		if !atomic.CompareAndSwapInt32(&released, 0, 1) {
+			return
+		}
+
+		select {
+		case <-s.ch:
+			if s.dbg != nil {
+				s.dbg.untrack(holder)
+			}
+		default:
+			if s.dbg != nil {
+				s.dbg.overRelease()
+			}
+		}
+	}
+}
+
+// A holder of permits
+type Holder struct {
+	// ID of the goroutine who acquired the permits. See runtime/gid.
+	// Only makes sense during the life cycle of the goroutine.
+	Gid uint
+	// The number of permits held
+	N int
+	// When the first permit held was acquired
+	Since time.Time
+}
+
+// Return holders of permits, the oldest first. Empty unless created by NewConf with Track.
+// A permit released by a goroutine other than its holder is deemed to be released by the oldest holder,
+// unless released via the func returned by AcquireFunc or TryAcquireFunc.
+func (s *Sem) Holders() []Holder {
+	if s.dbg == nil {
+		return nil
+	}
+
+	return s.dbg.snapshot()
+}
+
+type debug struct {
+	strict   bool
+	onMisuse func(err error)
+	trackOn  bool
+
+	mu      sync.Mutex
+	holders map[uint]*Holder
+}
+
+func (d *debug) overRelease() {
+	if d.strict {
+		d.onMisuse(ErrOverRelease)
+	}
+}
+
+func (d *debug) track() {
+	if !d.trackOn {
+		return
+	}
+
+	id := gid.Gid()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, ok := d.holders[id]
+	if !ok {
+		h = &Holder{Gid: id, Since: time.Now()}
+		d.holders[id] = h
+	}
+	h.N++
+}
+
+// Untrack a permit of the holder. If holder is 0, the current goroutine.
+func (d *debug) untrack(holder uint) {
+	if !d.trackOn {
+		return
+	}
+
+	if holder == 0 {
+		holder = gid.Gid()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	h, ok := d.holders[holder]
+	if !ok {
+		// released by another goroutine
+		h = d.oldest()
+		if h == nil {
+			return
+		}
+	}
+
+	h.N--
+	if h.N <= 0 {
+		delete(d.holders, h.Gid)
+	}
+}
+
+// Must be called with mu held.
+func (d *debug) oldest() *Holder {
+	var o *Holder
+	for _, h := range d.holders {
+		if o == nil || h.Since.Before(o.Since) {
+			o = h
+		}
+	}
+	return o
+}
+
+func (d *debug) snapshot() []Holder {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	hs := make([]Holder, 0, len(d.holders))
+	for _, h := range d.holders {
+		hs = append(hs, *h)
+	}
+
+	sort.Slice(hs, func(i, j int) bool {
+		return hs[i].Since.Before(hs[j].Since)
+	})
+	return hs
+}
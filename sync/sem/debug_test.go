@@ -0,0 +1,109 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"testing"
+
+	"github.com/burningxflame/gx/runtime/gid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrict(t *testing.T) {
+	as := require.New(t)
+
+	s := NewConf(SemConf{Cap: ca, Strict: true})
+	as.Nil(s.Acquire(context.Background()))
+	s.Release()
+	as.PanicsWithError(ErrOverRelease.Error(), s.Release)
+
+	var errs []error
+	s = NewConf(SemConf{Cap: ca, Strict: true, OnMisuse: func(err error) {
+		errs = append(errs, err)
+	}})
+	as.True(s.TryAcquire())
+	s.Release()
+	s.Release()
+	as.Equal([]error{ErrOverRelease}, errs)
+
+	// not strict, no-op
+	s = NewConf(SemConf{Cap: ca})
+	as.Nil(s.dbg)
+	s.Release()
+}
+
+func TestAcquireFunc(t *testing.T) {
+	as := require.New(t)
+
+	s := NewConf(SemConf{Cap: ca, Strict: true})
+	release, err := s.AcquireFunc(context.Background())
+	as.Nil(err)
+	as.Equal(ca-1, s.Available())
+
+	// idempotent
+	release()
+	release()
+	as.Equal(ca, s.Available())
+
+	for i := 0; i < ca; i++ {
+		_, ok := s.TryAcquireFunc()
+		as.True(ok)
+	}
+	_, ok := s.TryAcquireFunc()
+	as.False(ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	_, err = s.AcquireFunc(ctx)
+	as.Error(err)
+}
+
+func TestHolders(t *testing.T) {
+	as := require.New(t)
+
+	s := NewConf(SemConf{Cap: ca, Track: true})
+	as.Nil(s.Acquire(context.Background()))
+	as.True(s.TryAcquire())
+
+	hs := s.Holders()
+	as.Len(hs, 1)
+	as.Equal(gid.Gid(), hs[0].Gid)
+	as.Equal(2, hs[0].N)
+
+	// acquired by another goroutine, released via the func by yet another one
+	ch := make(chan func())
+	go func() {
+		release, err := s.AcquireFunc(context.Background())
+		as.Nil(err)
+		ch <- release
+	}()
+	release := <-ch
+	as.Len(s.Holders(), 2)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		release()
+		// released by a non-holder, deemed to be released by the oldest holder
+		s.Release()
+	}()
+	<-done
+
+	hs = s.Holders()
+	as.Len(hs, 1)
+	as.Equal(gid.Gid(), hs[0].Gid)
+	as.Equal(1, hs[0].N)
+
+	s.Release()
+	as.Empty(s.Holders())
+
+	// not tracked
+	as.Nil(New(ca).Holders())
+}
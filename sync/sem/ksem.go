@@ -9,72 +9,96 @@ Read the LICENSE file for details.
 package sem
 
 import (
+	"context"
 	"math"
-	"sync"
+	"time"
+
+	"github.com/burningxflame/gx/sync/internal/lru"
 )
 
 // Keyed-Semaphores. Commonly used for limiting max concurrency per key, e.g. limiting max number of concurrent connections per client.
 type KSem[K comparable] struct {
 	ca       int
 	sizeHint int
-	sems     sync.Map
-	mu       sync.Mutex
-	size     int
+	idx      *lru.Index[K, *Sem]
+}
+
+type KSemConf struct {
+	// Capacity of every semaphore. Default to 1.
+	Cap int
+	// If the number of semaphores exceeds SizeHint, the least recently used ones who have no permits taken are evicted.
+	// Semaphores who have permits taken are never evicted, so the number may exceed SizeHint by the number of busy keys.
+	// Default to no limit.
+	SizeHint int
+	// Semaphores who have no permits taken and are not used, i.e. got, for IdleTTL are evicted.
+	// Default to 0, i.e. no TTL.
+	IdleTTL time.Duration
+}
+
+// Stats of Keyed-Semaphores
+type KSemStats struct {
+	// The number of live keys
+	Live int
+	// The number of evicted keys so far
+	Evictions int64
 }
 
 // Create Keyed-Semaphores.
 // The ca specifies the capacity of every semaphore.
-// If the number of semaphores exceeds sizeHint, will try to shrink, i.e. remove semaphores who have no permits taken.
+// If the number of semaphores exceeds sizeHint, will try to shrink, i.e. remove the least recently used semaphores who have no permits taken.
 func NewKSem[K comparable](ca int, sizeHint int) *KSem[K] {
-	if ca < 1 {
-		ca = defCap
-	}
-
-	if sizeHint < 1 {
-		sizeHint = math.MaxInt
-	}
+	return NewKSemConf[K](KSemConf{Cap: ca, SizeHint: sizeHint})
+}
 
-	return &KSem[K]{
-		ca:       ca,
-		sizeHint: sizeHint,
-	}
+// Create Keyed-Semaphores with an eviction policy.
+func NewKSemConf[K comparable](cf KSemConf) *KSem[K] {
+	return newKSem[K](cf, time.Now)
 }
 
-// Get the semaphore of the key, create if not exist.
-func (ks *KSem[K]) Get(key K) *Sem {
-	s, ok := ks.sems.Load(key)
-	if ok {
-		return s.(*Sem)
+func newKSem[K comparable](cf KSemConf, now func() time.Time) *KSem[K] {
+	if cf.Cap < 1 {
+		cf.Cap = defCap
 	}
 
-	ks.mu.Lock()
-	defer ks.mu.Unlock()
-
-	// may have been created
-	s, ok = ks.sems.Load(key)
-	if ok {
-		return s.(*Sem)
+	if cf.SizeHint < 1 {
+		cf.SizeHint = math.MaxInt
 	}
 
-	if ks.size >= ks.sizeHint {
-		ks.shrink()
+	ks := &KSem[K]{
+		ca:       cf.Cap,
+		sizeHint: cf.SizeHint,
 	}
+	ks.idx = lru.New[K](lru.Conf[*Sem]{
+		New: func() *Sem {
+			return New(ks.ca)
+		},
+		TTL:      cf.IdleTTL,
+		SizeHint: cf.SizeHint,
+		Evictable: func(s *Sem) bool {
+			return s.Available() == ks.ca
+		},
+		Now: now,
+	})
+	return ks
+}
 
-	s2 := New(ks.ca)
-
-	ks.sems.Store(key, s2)
-	ks.size++
+// Get the semaphore of the key, create if not exist. Lock-free if exist.
+func (ks *KSem[K]) Get(key K) *Sem {
+	return ks.idx.Get(key)
+}
 
-	return s2
+// Return stats of the Keyed-Semaphores.
+func (ks *KSem[K]) Stats() KSemStats {
+	live, evictions := ks.idx.Stats()
+	return KSemStats{
+		Live:      live,
+		Evictions: evictions,
+	}
 }
 
-func (ks *KSem[K]) shrink() {
-	ks.sems.Range(func(key, value any) bool {
-		s := value.(*Sem)
-		if s.Available() == ks.ca {
-			ks.sems.Delete(key)
-			ks.size--
-		}
-		return true
-	})
+// Evict idle semaphores periodically, i.e. every IdleTTL/2, until ctx.Done channel is closed.
+// Without the janitor, idle semaphores are only evicted on Get of new keys.
+// Return immediately if IdleTTL is not set.
+func (ks *KSem[K]) RunJanitor(ctx context.Context) {
+	ks.idx.RunJanitor(ctx)
 }
@@ -13,6 +13,7 @@ import (
 	"math"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -57,13 +58,13 @@ func TestKSemShrink(t *testing.T) {
 	for i := 1; i <= sizeHint; i++ {
 		s := ks.Get(key + strconv.Itoa(i))
 		as.True(s.TryAcquire())
-		as.Equal(i, ks.size)
+		as.Equal(i, ks.Stats().Live)
 	}
 
 	ks.Get(key + "1").Release()
 
 	ks.Get(key + strconv.Itoa(sizeHint+1))
-	as.Equal(sizeHint, ks.size)
+	as.Equal(sizeHint, ks.Stats().Live)
 }
 
 func TestKSemShrinkNone(t *testing.T) {
@@ -74,11 +75,11 @@ func TestKSemShrinkNone(t *testing.T) {
 	for i := 1; i <= sizeHint; i++ {
 		s := ks.Get(key + strconv.Itoa(i))
 		as.True(s.TryAcquire())
-		as.Equal(i, ks.size)
+		as.Equal(i, ks.Stats().Live)
 	}
 
 	ks.Get(key + strconv.Itoa(sizeHint+1))
-	as.Equal(sizeHint+1, ks.size)
+	as.Equal(sizeHint+1, ks.Stats().Live)
 }
 
 func TestKSemCapLow(t *testing.T) {
@@ -97,3 +98,83 @@ func TestKSemSizeHintLow(t *testing.T) {
 	ks := NewKSem[string](ca, 0)
 	as.Equal(math.MaxInt, ks.sizeHint)
 }
+
+func TestKSemLRU(t *testing.T) {
+	as := require.New(t)
+
+	c := &fakeClock{t: time.Now()}
+	ks := newKSem[string](KSemConf{Cap: ca, SizeHint: sizeHint}, c.now)
+	ks.Get(key + "1")
+	c.t = c.t.Add(time.Millisecond)
+	ks.Get(key + "2")
+	c.t = c.t.Add(time.Millisecond)
+	// key1 is more recently used than key2
+	ks.Get(key + "1")
+
+	ks.Get(key + "3")
+	as.True(has(ks, key+"1"))
+	as.False(has(ks, key+"2"))
+	as.Equal(KSemStats{Live: sizeHint, Evictions: 1}, ks.Stats())
+}
+
+func TestKSemIdleTTL(t *testing.T) {
+	as := require.New(t)
+
+	const ttl = time.Minute
+	c := &fakeClock{t: time.Now()}
+	ks := newKSem[string](KSemConf{Cap: ca, IdleTTL: ttl}, c.now)
+
+	as.True(ks.Get(key + "1").TryAcquire())
+	ks.Get(key + "2")
+	c.t = c.t.Add(ttl / 2)
+	ks.Get(key + "3")
+
+	// key1 and key2 expire, but key1 is busy
+	c.t = c.t.Add(ttl / 2)
+	ks.Get(key + "4")
+	as.Equal(3, ks.Stats().Live)
+	as.False(has(ks, key+"2"))
+	as.True(has(ks, key+"1"))
+
+	// key1 released, and all expire
+	ks.Get(key + "1").Release()
+	c.t = c.t.Add(ttl)
+	ks.Get(key + "5")
+	as.Equal(KSemStats{Live: 1, Evictions: 4}, ks.Stats())
+}
+
+func TestKSemJanitor(t *testing.T) {
+	as := require.New(t)
+
+	const (
+		ttl = time.Millisecond * 20
+		n   = 300
+	)
+	ks := NewKSemConf[string](KSemConf{Cap: ca, IdleTTL: ttl})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ks.RunJanitor(ctx)
+	}()
+
+	for i := 0; i < n; i++ {
+		ks.Get(key + strconv.Itoa(i))
+	}
+	as.Eventually(func() bool {
+		return ks.Stats().Live == 0
+	}, time.Second, ttl)
+	as.Equal(int64(n), ks.Stats().Evictions)
+
+	cancel()
+	<-done
+
+	// no TTL, return immediately
+	NewKSem[string](ca, sizeHint).RunJanitor(context.Background())
+}
+
+func has(ks *KSem[string], k string) bool {
+	_, ok := ks.idx.Peek(k)
+	return ok
+}
@@ -0,0 +1,37 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"reflect"
+)
+
+// Limiter limits max concurrency. Implemented by Sem, Adaptive, Weighted and Priority.
+type Limiter interface {
+	// Acquire a permit.
+	// If none is available, block until one is available or ctx.Done channel is closed.
+	Acquire(ctx context.Context) error
+	// Try to acquire a permit.
+	// Return true if available, false otherwise.
+	TryAcquire() bool
+	// Release a permit.
+	Release()
+}
+
+// Return true if l is nil, or a nil pointer wrapped in a non-nil interface, e.g. a nil *Sem.
+// Used to treat both as no limit.
+func IsNil(l Limiter) bool {
+	if l == nil {
+		return true
+	}
+
+	v := reflect.ValueOf(l)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
@@ -0,0 +1,202 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority semaphore, where waiters are served by priority, e.g. admin traffic bypasses the queue when saturated.
+// A waiter's priority is raised while waiting, i.e. aging, so that low priority waiters are not starved.
+type Priority struct {
+	ca    int
+	aging time.Duration
+	base  time.Time
+
+	mu      sync.Mutex
+	taken   int
+	waiters pwaiters
+	seq     uint64
+
+	now func() time.Time
+}
+
+type PriorityConf struct {
+	// Capacity of the semaphore. Default to 1.
+	Cap int
+	// A waiter's priority is raised by 1 for every Aging it waits. Default to 1s.
+	Aging time.Duration
+}
+
+const defAging = time.Second
+
+// Create a priority semaphore.
+func NewPriority(cf PriorityConf) *Priority {
+	if cf.Cap < 1 {
+		cf.Cap = defCap
+	}
+	if cf.Aging <= 0 {
+		cf.Aging = defAging
+	}
+
+	p := &Priority{
+		ca:    cf.Cap,
+		aging: cf.Aging,
+		now:   time.Now,
+	}
+	p.base = p.now()
+	return p
+}
+
+// Acquire a permit with the priority. The greater, the higher priority.
+// If none is available, block until one is available or ctx.Done channel is closed.
+func (p *Priority) AcquireP(ctx context.Context, prio int) error {
+	p.mu.Lock()
+	if p.taken < p.ca {
+		p.taken++
+		p.mu.Unlock()
+		return nil
+	}
+
+	// Aging raises the priority of all waiters at the same rate,
+	// so the order of waiters is determined by priority minus enqueue time, which does not change while waiting.
+	p.seq++
+	wt := &pwaiter{
+		key:   float64(prio) - float64(p.now().Sub(p.base))/float64(p.aging),
+		seq:   p.seq,
+		ready: make(chan struct{}),
+	}
+	heap.Push(&p.waiters, wt)
+	p.mu.Unlock()
+
+	select {
+	case <-wt.ready:
+		return nil
+
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		select {
+		case <-wt.ready:
+			// Granted right after ctx is done. Give it back.
+			p.release()
+		default:
+			heap.Remove(&p.waiters, wt.idx)
+		}
+
+		return ctx.Err()
+	}
+}
+
+// Acquire a permit with priority 0. Same as AcquireP(ctx, 0).
+func (p *Priority) Acquire(ctx context.Context) error {
+	return p.AcquireP(ctx, 0)
+}
+
+// Try to acquire a permit.
+// Return true if available, false otherwise.
+func (p *Priority) TryAcquire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.taken >= p.ca {
+		return false
+	}
+
+	p.taken++
+	return true
+}
+
+// Release a permit to the semaphore, which is handed to the waiter of the highest priority if any.
+func (p *Priority) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.release()
+}
+
+// Return the number of available permits.
+func (p *Priority) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.ca - p.taken
+}
+
+// Return the number of waiters.
+func (p *Priority) Waiting() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.waiters.Len()
+}
+
+// Must be called with mu held.
+func (p *Priority) release() {
+	if p.taken == 0 {
+		return
+	}
+
+	if p.waiters.Len() == 0 {
+		p.taken--
+		return
+	}
+
+	// Hand the permit over.
+	wt := heap.Pop(&p.waiters).(*pwaiter)
+	close(wt.ready)
+}
+
+type pwaiter struct {
+	// The greater, the earlier served
+	key float64
+	// FIFO among equal keys
+	seq   uint64
+	idx   int
+	ready chan struct{}
+}
+
+// A max-heap of waiters, implementing heap.Interface
+type pwaiters []*pwaiter
+
+func (ws pwaiters) Len() int {
+	return len(ws)
+}
+
+func (ws pwaiters) Less(i, j int) bool {
+	if ws[i].key != ws[j].key {
+		return ws[i].key > ws[j].key
+	}
+	return ws[i].seq < ws[j].seq
+}
+
+func (ws pwaiters) Swap(i, j int) {
+	ws[i], ws[j] = ws[j], ws[i]
+	ws[i].idx = i
+	ws[j].idx = j
+}
+
+func (ws *pwaiters) Push(x any) {
+	wt := x.(*pwaiter)
+	wt.idx = len(*ws)
+	*ws = append(*ws, wt)
+}
+
+func (ws *pwaiters) Pop() any {
+	old := *ws
+	n := len(old)
+	wt := old[n-1]
+	old[n-1] = nil
+	*ws = old[:n-1]
+	return wt
+}
@@ -0,0 +1,86 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Limiter = (*Priority)(nil)
+
+// Enqueue waiters in order, and return the order in which they're served.
+func servePriority(as *require.Assertions, p *Priority, prios []int, advance func()) []int {
+	order := make(chan int, len(prios))
+	for i, prio := range prios {
+		i, prio := i, prio
+		go func() {
+			as.Nil(p.AcquireP(context.Background(), prio))
+			order <- i
+		}()
+		as.Eventually(func() bool {
+			return p.Waiting() == i+1
+		}, time.Second, time.Millisecond)
+		advance()
+	}
+
+	var got []int
+	for range prios {
+		p.Release()
+		got = append(got, <-order)
+	}
+	return got
+}
+
+func TestPriority(t *testing.T) {
+	as := require.New(t)
+
+	p := NewPriority(PriorityConf{Cap: ca})
+	for i := 0; i < ca; i++ {
+		as.True(p.TryAcquire())
+	}
+	as.False(p.TryAcquire())
+	as.Equal(0, p.Available())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	as.Error(p.AcquireP(ctx, 100))
+	as.Equal(0, p.Waiting())
+
+	// by priority, FIFO among equal ones
+	got := servePriority(as, p, []int{0, 1, 5, 1, 0}, func() {})
+	as.Equal([]int{2, 1, 3, 0, 4}, got)
+
+	for i := 0; i < ca; i++ {
+		p.Release()
+	}
+	// no-op if none taken
+	p.Release()
+	as.Equal(ca, p.Available())
+}
+
+func TestPriorityAging(t *testing.T) {
+	as := require.New(t)
+
+	c := &fakeClock{t: time.Now()}
+	p := NewPriority(PriorityConf{Cap: 1, Aging: time.Second})
+	p.now = c.now
+	p.base = c.t
+	as.True(p.TryAcquire())
+
+	// Each waits 1s longer than the next, i.e. raised by 1 more.
+	got := servePriority(as, p, []int{0, 2, 1, 3}, func() {
+		c.t = c.t.Add(time.Second)
+	})
+	// effective priorities: 0+3, 2+2, 1+1, 3+0, FIFO among equal ones
+	as.Equal([]int{1, 0, 3, 2}, got)
+}
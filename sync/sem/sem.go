@@ -15,6 +15,8 @@ import (
 // Semaphore is commonly used for limiting max concurrency, e.g. limiting max number of concurrent connections.
 type Sem struct {
 	ch chan struct{}
+	// nil unless created by NewConf with Strict or Track
+	dbg *debug
 }
 
 // Create a semaphore.
@@ -36,6 +38,9 @@ const defCap = 1
 func (s *Sem) Acquire(ctx context.Context) error {
 	select {
 	case s.ch <- s0:
+		if s.dbg != nil {
+			s.dbg.track()
+		}
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -49,6 +54,9 @@ var s0 = struct{}{}
 func (s *Sem) TryAcquire() bool {
 	select {
 	case s.ch <- struct{}{}:
+		if s.dbg != nil {
+			s.dbg.track()
+		}
 		return true
 	default:
 		return false
@@ -56,10 +64,17 @@ func (s *Sem) TryAcquire() bool {
 }
 
 // Release a permit to the semaphore.
+// No-op if none is taken, unless in strict mode, in which case it's reported as ErrOverRelease.
 func (s *Sem) Release() {
 	select {
 	case <-s.ch:
+		if s.dbg != nil {
+			s.dbg.untrack(0)
+		}
 	default:
+		if s.dbg != nil {
+			s.dbg.overRelease()
+		}
 	}
 }
 
@@ -110,3 +110,14 @@ func TestCapLow(t *testing.T) {
 	s := New(0)
 	as.Equal(defCap, s.Available())
 }
+
+func TestIsNil(t *testing.T) {
+	as := require.New(t)
+
+	var s *Sem
+	var a *Adaptive
+	as.True(IsNil(nil))
+	as.True(IsNil(s))
+	as.True(IsNil(a))
+	as.False(IsNil(New(ca)))
+}
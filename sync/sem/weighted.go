@@ -0,0 +1,175 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+)
+
+// Weighted semaphore, where a caller may acquire multiple permits at a time, e.g. bounding memory by bytes.
+// Waiters are served in FIFO order, so that large requests are not starved by small ones.
+type Weighted struct {
+	ca int64
+
+	mu      sync.Mutex
+	taken   int64
+	waiters list.List // of *waiter
+}
+
+type waiter struct {
+	n     int64
+	ready chan struct{}
+}
+
+var (
+	ErrExceedCap = errors.New("number of permits exceeds the capacity")
+	ErrNegative  = errors.New("negative number of permits")
+)
+
+// Create a weighted semaphore.
+// The ca specifies the capacity of the semaphore.
+func NewWeighted(ca int64) *Weighted {
+	if ca < 1 {
+		ca = defCap
+	}
+
+	return &Weighted{ca: ca}
+}
+
+// Acquire n permits from the semaphore.
+// If not available, block until available or ctx.Done channel is closed.
+// Return ErrExceedCap if n exceeds the capacity, or ErrNegative if n is negative. No-op if n is 0.
+func (w *Weighted) AcquireN(ctx context.Context, n int64) error {
+	if n < 0 {
+		return ErrNegative
+	}
+	if n == 0 {
+		return nil
+	}
+	if n > w.ca {
+		return ErrExceedCap
+	}
+
+	w.mu.Lock()
+	if w.waiters.Len() == 0 && w.ca-w.taken >= n {
+		w.taken += n
+		w.mu.Unlock()
+		return nil
+	}
+
+	wt := &waiter{n: n, ready: make(chan struct{})}
+	elem := w.waiters.PushBack(wt)
+	w.mu.Unlock()
+
+	select {
+	case <-wt.ready:
+		return nil
+
+	case <-ctx.Done():
+		w.mu.Lock()
+		defer w.mu.Unlock()
+
+		select {
+		case <-wt.ready:
+			// Granted right after ctx is done. Give it back.
+			w.taken -= n
+		default:
+			w.waiters.Remove(elem)
+		}
+
+		// Waiters behind may be servable now.
+		w.notify()
+		return ctx.Err()
+	}
+}
+
+// Try to acquire n permits from the semaphore.
+// Return true if available, false otherwise, or if n is negative. Always true if n is 0.
+func (w *Weighted) TryAcquireN(n int64) bool {
+	if n < 0 {
+		return false
+	}
+	if n == 0 {
+		return true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.waiters.Len() > 0 || w.ca-w.taken < n {
+		return false
+	}
+
+	w.taken += n
+	return true
+}
+
+// Release n permits to the semaphore.
+// Releasing more than taken releases all. No-op if n is 0. Panic if n is negative.
+func (w *Weighted) ReleaseN(n int64) {
+	if n < 0 {
+		panic(ErrNegative)
+	}
+	if n == 0 {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.taken -= n
+	if w.taken < 0 {
+		w.taken = 0
+	}
+
+	w.notify()
+}
+
+// Acquire a permit. Same as AcquireN(ctx, 1).
+func (w *Weighted) Acquire(ctx context.Context) error {
+	return w.AcquireN(ctx, 1)
+}
+
+// Try to acquire a permit. Same as TryAcquireN(1).
+func (w *Weighted) TryAcquire() bool {
+	return w.TryAcquireN(1)
+}
+
+// Release a permit. Same as ReleaseN(1).
+func (w *Weighted) Release() {
+	w.ReleaseN(1)
+}
+
+// Return the number of available permits.
+func (w *Weighted) Available() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.ca - w.taken
+}
+
+// Grant permits to waiters in FIFO order while available.
+// Stop at the first waiter which cannot be served, so that it's not starved.
+// Must be called with mu held.
+func (w *Weighted) notify() {
+	for w.waiters.Len() > 0 {
+		elem := w.waiters.Front()
+		wt := elem.Value.(*waiter)
+		if w.ca-w.taken < wt.n {
+			return
+		}
+
+		w.taken += wt.n
+		w.waiters.Remove(elem)
+		close(wt.ready)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+GX (github.com/burningxflame/gx).
+Copyright © 2022-2024 BurningXFlame. All rights reserved.
+
+Dual-licensed: AGPLv3/Commercial.
+Read the LICENSE file for details.
+*/
+
+package sem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var _ Limiter = (*Weighted)(nil)
+
+func TestWeighted(t *testing.T) {
+	as := require.New(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	w := NewWeighted(10)
+	as.Nil(w.AcquireN(ctx, 4))
+	as.True(w.TryAcquireN(6))
+	as.False(w.TryAcquire())
+	as.Equal(int64(0), w.Available())
+	as.Error(w.AcquireN(ctx, 1))
+
+	w.ReleaseN(6)
+	as.Equal(int64(6), w.Available())
+	as.Nil(w.Acquire(context.Background()))
+	w.Release()
+
+	as.ErrorIs(w.AcquireN(context.Background(), 11), ErrExceedCap)
+
+	// releasing more than taken releases all
+	w.ReleaseN(100)
+	as.Equal(int64(10), w.Available())
+}
+
+func TestWeightedFIFO(t *testing.T) {
+	as := require.New(t)
+
+	w := NewWeighted(10)
+	as.True(w.TryAcquireN(8))
+
+	// A large request waits first. Small requests arriving later must wait behind it, rather than starve it.
+	order := make(chan int64, 3)
+	for _, n := range []int64{5, 1, 1} {
+		n := n
+		go func() {
+			as.Nil(w.AcquireN(context.Background(), n))
+			order <- n
+		}()
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// 2 available, but the head waits for 5.
+	as.False(w.TryAcquire())
+	time.Sleep(time.Millisecond * 10)
+	as.Len(order, 0)
+
+	// Only the head is served.
+	w.ReleaseN(3)
+	as.Equal(int64(5), <-order)
+	time.Sleep(time.Millisecond * 10)
+	as.Len(order, 0)
+
+	w.ReleaseN(2)
+	as.Equal(int64(1), <-order)
+	as.Equal(int64(1), <-order)
+	as.Equal(int64(0), w.Available())
+}
+
+func TestWeightedCancel(t *testing.T) {
+	as := require.New(t)
+
+	w := NewWeighted(10)
+	as.True(w.TryAcquireN(8))
+
+	// The head waiter gives up, and the waiter behind it is served.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- w.AcquireN(ctx, 5)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	got := make(chan struct{})
+	go func() {
+		as.Nil(w.AcquireN(context.Background(), 2))
+		close(got)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	cancel()
+	as.ErrorIs(<-done, context.Canceled)
+	<-got
+	as.Equal(int64(0), w.Available())
+}
+
+func TestWeightedInvalidN(t *testing.T) {
+	as := require.New(t)
+
+	w := NewWeighted(ca)
+	as.ErrorIs(w.AcquireN(context.Background(), -5), ErrNegative)
+	as.False(w.TryAcquireN(-5))
+	as.PanicsWithError(ErrNegative.Error(), func() {
+		w.ReleaseN(-5)
+	})
+	as.Equal(int64(ca), w.Available())
+
+	// no-op
+	as.Nil(w.AcquireN(context.Background(), 0))
+	as.True(w.TryAcquireN(0))
+	as.Equal(int64(ca), w.Available())
+
+	as.True(w.TryAcquire())
+	w.ReleaseN(0)
+	as.Equal(int64(ca-1), w.Available())
+}
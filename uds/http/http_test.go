@@ -24,6 +24,7 @@ import (
 
 	"github.com/burningxflame/gx/id/uuid"
 	"github.com/burningxflame/gx/log/light"
+	"github.com/burningxflame/gx/reliable/readiness"
 )
 
 const (
@@ -61,6 +62,40 @@ func TestServerClient(t *testing.T) {
 	as.Nil(<-chServe)
 }
 
+func TestDrain(t *testing.T) {
+	light.InitTestLog()
+	as := require.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	udsAddr := filepath.Join(t.TempDir(), udsName)
+	rs := &readiness.Server{}
+	const delay = time.Millisecond * 100
+
+	chServe := make(chan error, 1)
+	go func() {
+		s := &Server{
+			Std: http.Server{
+				Handler: http.HandlerFunc(handleEcho),
+			},
+			Tag:        tag,
+			UdsAddr:    udsAddr,
+			Readiness:  rs,
+			DrainDelay: delay,
+		}
+		chServe <- s.Serve(ctx)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	cancel()
+	// marked draining, and still serving during DrainDelay
+	as.Eventually(func() bool {
+		return !rs.Ready()
+	}, time.Second, time.Millisecond)
+	req(as, udsAddr)
+
+	as.Nil(<-chServe)
+}
+
 func handleEcho(w http.ResponseWriter, r *http.Request) {
 	io.Copy(w, r.Body)
 }
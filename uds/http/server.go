@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/burningxflame/gx/log/log"
+	"github.com/burningxflame/gx/reliable/readiness"
 	sh "github.com/burningxflame/gx/secure/http"
 	"github.com/burningxflame/gx/sync/sem"
 )
@@ -30,11 +31,17 @@ type Server struct {
 	UdsAddr string
 	// File permission of the UdsAddr
 	Perm fs.FileMode
-	// Used to limit max number of concurrent requests.
-	// Default to no limit.
-	Limiter *sem.Sem
+	// Used to limit max number of concurrent requests, e.g. sem.New(n) or sem.NewAdaptive(cf).
+	// Default to no limit. A nil interface or nil pointer means no limit.
+	Limiter sem.Limiter
 	// If graceful shutdown takes longer than ShutdownTimeout, exit instantly.
 	ShutdownTimeout time.Duration
+	// If set, MarkDraining is called on exit signal before shutting down, e.g. with a *readiness.Server,
+	// so that probes fail and no new traffic is routed here, e.g. by a local proxy.
+	Readiness readiness.Drainer
+	// How long to wait after MarkDraining before shutting down, so that proxies notice.
+	// Default to 0.
+	DrainDelay time.Duration
 	// Used to tag log messages
 	Tag string
 	// A TagLogger used to log messages
@@ -66,7 +73,7 @@ func (s *Server) Serve(ctx context.Context) error {
 		}
 	}
 
-	if s.Limiter != nil {
+	if !sem.IsNil(s.Limiter) {
 		origHandler := s.Std.Handler
 		defer func() {
 			s.Std.Handler = origHandler
@@ -86,6 +93,7 @@ func (s *Server) Serve(ctx context.Context) error {
 
 	case <-ctx.Done():
 		lg.Info("received exit signal, exiting")
+		readiness.Drain(s.Readiness, s.DrainDelay)
 
 		ctx, cancel := context.WithTimeout(ctx, s.ShutdownTimeout)
 		defer cancel()